@@ -17,10 +17,29 @@ package api
 // Internal API error codes
 const (
 	ErrorRedis          = "err_redis"
+	ErrorTimeout        = "err_timeout"
 	ErrorCreatingToken  = "err_creating_token"
 	ErrorParsingRequest = "err_parsing_token"
 	ErrorInvalidToken   = "invalid_token"
 	ErrorInvalidClient  = "invalid_client"
+
+	ErrorUnauthorizedCaller = "unauthorized_caller"
+	ErrorInvalidBinding     = "invalid_token_binding"
+	ErrorInvalidDPoPProof   = "invalid_dpop_proof"
+	ErrorFailedAssertion    = "failed_assertion"
+	ErrorPolicyDenied       = "policy_denied"
+	ErrorNotFound           = "not_found"
+)
+
+// OAuth 2.0 error codes (RFC 6749)
+const (
+	ErrorInvalidRequest       = "invalid_request"
+	ErrorInvalidGrant         = "invalid_grant"
+	ErrorInvalidScope         = "invalid_scope"
+	ErrorUnauthorizedClient   = "unauthorized_client"
+	ErrorUnsupportedGrantType = "unsupported_grant_type"
+	ErrorInvalidTarget        = "invalid_target"     // RFC 8693
+	ErrorInsufficientScope    = "insufficient_scope" // RFC 6750
 )
 
 // ErrorMessages has the descriptions associated to the API error codes
@@ -30,8 +49,22 @@ var ErrorMessages map[string]string
 func InitErrorMessages() {
 	ErrorMessages = make(map[string]string)
 	ErrorMessages[ErrorRedis] = "There was an error connecting to the Redis Server"
+	ErrorMessages[ErrorTimeout] = "Timeout waiting for the Redis Server"
 	ErrorMessages[ErrorCreatingToken] = "Error creating auth token"
 	ErrorMessages[ErrorParsingRequest] = "Error parsing token"
 	ErrorMessages[ErrorInvalidToken] = "Invalid token"
 	ErrorMessages[ErrorInvalidClient] = "Invalid client"
+	ErrorMessages[ErrorUnauthorizedCaller] = "Caller not authorized for the client"
+	ErrorMessages[ErrorInvalidBinding] = "Token not bound to the key presented"
+	ErrorMessages[ErrorInvalidDPoPProof] = "Invalid DPoP proof"
+	ErrorMessages[ErrorFailedAssertion] = "Token claims do not pass the assertion"
+	ErrorMessages[ErrorPolicyDenied] = "Request denied by the client policies"
+	ErrorMessages[ErrorNotFound] = "Resource not found"
+	ErrorMessages[ErrorInvalidRequest] = "Invalid request"
+	ErrorMessages[ErrorInvalidGrant] = "Invalid or expired grant"
+	ErrorMessages[ErrorInvalidScope] = "Requested scope not allowed for the client"
+	ErrorMessages[ErrorUnauthorizedClient] = "Client not allowed to use this grant type"
+	ErrorMessages[ErrorUnsupportedGrantType] = "Unsupported grant type"
+	ErrorMessages[ErrorInvalidTarget] = "Audience not allowed for the client"
+	ErrorMessages[ErrorInsufficientScope] = "Token does not have the required scopes"
 }
@@ -24,11 +24,134 @@ import (
 type Token struct {
 	Token     string `json:"token,omitempty"`
 	ExpiresIn int    `json:"expires_in,omitempty"`
+
+	// thumbprint of the client certificate presented along with the token
+	CertificateThumbprint string `json:"x5t#S256,omitempty"`
+
+	// DPoP proof presented along with the token, for the request method and URL
+	DPoP string `json:"dpop,omitempty"`
+	HTM  string `json:"htm,omitempty"`
+	HTU  string `json:"htu,omitempty"`
+
+	// scopes the token must have to be valid
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+
+	// checks on the claims the token must pass to be valid
+	Assertions []ClaimAssertion `json:"assertions,omitempty"`
+}
+
+// ClaimAssertion is a check on a claim of the token, nested claims are named
+// with dots (e.g. "act.sub"). A missing claim fails the assertions checking its
+// value, required is for assertions only checking the claim is present.
+type ClaimAssertion struct {
+	Claim    string        `json:"claim"`
+	Required bool          `json:"required,omitempty"`
+	Equals   interface{}   `json:"equals,omitempty"`
+	In       []interface{} `json:"in,omitempty"`      // for arrays, every value must be in the set
+	Matches  string        `json:"matches,omitempty"` // regular expression
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+}
+
+// Confirmation holds the proof-of-possession key a token is bound to
+type Confirmation struct {
+	CertificateThumbprint string // RFC 8705 x5t#S256
+	KeyThumbprint         string // RFC 9449 jkt
+}
+
+// DPoPProof is a RFC 9449 proof received with a request, with the method and
+// URL of the request it must have been created for
+type DPoPProof struct {
+	Proof  string
+	Method string
+	URL    string
 }
 
 // Claim represents a request/response
 type Claim struct {
-	Claims map[string]interface{} `json:"claims"`
+	Claims         map[string]interface{} `json:"claims"`
+	BlacklistCheck string                 `json:"blacklist_check,omitempty"`
+}
+
+// Values for Claim.BlacklistCheck, set when the blacklist store could not be reached
+const (
+	BlacklistCheckSkipped = "skipped" // token accepted without checking the blacklist
+	BlacklistCheckLocal   = "local"   // only revocations known by this instance were checked
+)
+
+// TokenHint represents a RFC 7662 introspection or RFC 7009 revocation
+// form-encoded request
+type TokenHint struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// TokenGrant represents a RFC 6749 form-encoded token request. Client
+// credentials are read separately, as part of the client authentication.
+type TokenGrant struct {
+	GrantType string `form:"grant_type" binding:"required"`
+	Scope     string `form:"scope"`
+
+	// RFC 8693 token exchange
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	ActorToken         string `form:"actor_token"`
+	ActorTokenType     string `form:"actor_token_type"`
+	RequestedTokenType string `form:"requested_token_type"`
+	Audience           string `form:"audience"`
+}
+
+// OAuthToken is the RFC 6749 token response
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // RFC 8693
+}
+
+// Discovery is the OpenID Connect discovery document (RFC 8414 metadata)
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported"`
+	TLSClientCertificateBoundTokens   bool     `json:"tls_client_certificate_bound_access_tokens"`
+}
+
+// LifecycleEvent is sent to the webhooks when tokens are generated, destroyed,
+// revoked or fail to validate
+type LifecycleEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Time    int64  `json:"time"`
+	Client  string `json:"client"`
+	Subject string `json:"sub,omitempty"`
+	JTI     string `json:"jti,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+
+	// the subject and jti were read from a token whose signature could not be
+	// verified, so anyone could have set them. Only for validation failures.
+	Unverified bool `json:"unverified,omitempty"`
+}
+
+// RevocationEvent is published every time a token is destroyed
+type RevocationEvent struct {
+	ID        string `json:"id"` // hash of the raw token
+	JTI       string `json:"jti,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Client    string `json:"client"`
+	ExpiresAt int64  `json:"exp,omitempty"`
 }
 
 // TokenValidResponse is the response used for a /token/validate operation
@@ -75,6 +198,19 @@ func (response *Response) Send(w http.ResponseWriter) {
 type ErrorData struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
+
+	// assertion the token failed, for failed_assertion errors
+	Assertion *ClaimAssertion `json:"assertion,omitempty"`
+
+	// policies denying the request, for policy_denied errors
+	Denials []PolicyDenial `json:"denials,omitempty"`
+}
+
+// PolicyDenial identifies a policy denying a request
+type PolicyDenial struct {
+	Policy  string `json:"policy"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"evaluation_error,omitempty"`
 }
 
 // Marshall encodes ErrorData content to a json byte array
@@ -0,0 +1,55 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// jwt-audit verifies the hash chain of an audit trail:
+//
+//	jwt-audit verify audit.jsonl
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fcoders/jwt-service/core/audit"
+)
+
+func main() {
+	if len(os.Args) != 3 || os.Args[1] != "verify" {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify <audit file>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	file, err := os.Open(os.Args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open audit file: %s\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	records, err := audit.Verify(file)
+	if err != nil {
+		if records > 0 {
+			fmt.Fprintf(os.Stderr, "Audit trail valid from record 1 to %d only: %s\n", records, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Audit trail not valid: %s\n", err)
+		}
+		os.Exit(1)
+	}
+
+	if records == 0 {
+		fmt.Println("Audit trail empty")
+		return
+	}
+	fmt.Printf("Audit trail valid, records 1 to %d\n", records)
+}
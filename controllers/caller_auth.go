@@ -0,0 +1,100 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/audit"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCallerBodySize = 1 << 20 // the body is read whole to verify its signature
+)
+
+// CallerAuthentication rejects the requests whose caller cannot prove it owns
+// the client in the Auth-Client header
+func CallerAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		body, errRead := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCallerBodySize))
+		if errRead != nil {
+			apiResponse := &api.Response{Status: http.StatusBadRequest, ErrorCode: api.ErrorParsingRequest}
+			apiResponse.Send(c.Writer)
+			c.Abort()
+			return
+		}
+
+		// the handlers read the body again
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		clientID := c.Request.Header.Get("Auth-Client")
+		if len(clientID) > 0 {
+			if err := clients.AuthenticateCaller(c.Request, body, clientID); err != nil {
+				apiResponse := &api.Response{Status: http.StatusUnauthorized, ErrorCode: api.ErrorUnauthorizedCaller}
+				apiResponse.Send(c.Writer)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// AuditCaller keeps the address and certificate of the caller in the request
+// context, for the audit trail
+func AuditCaller() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := audit.Caller{Address: c.ClientIP()}
+		if cert := clients.VerifiedCertificate(c.Request); cert != nil {
+			caller.Certificate = cert.Subject.String()
+		}
+
+		c.Request = c.Request.WithContext(audit.WithCaller(c.Request.Context(), caller))
+		c.Next()
+	}
+}
+
+// CertificateIdentity sets the Auth-Client header from the verified TLS client
+// certificate, when its subject is mapped to a client. Requests naming a
+// different client in the header are rejected.
+func CertificateIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if cert := clients.VerifiedCertificate(c.Request); cert != nil {
+			if id, found := clients.ClientForCertificate(cert); found {
+
+				clientID := c.Request.Header.Get("Auth-Client")
+				if len(clientID) == 0 {
+					c.Request.Header.Set("Auth-Client", id)
+
+				} else if clientID != id {
+					apiResponse := &api.Response{Status: http.StatusUnauthorized, ErrorCode: api.ErrorUnauthorizedCaller}
+					apiResponse.Send(c.Writer)
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCallerAuthentication(t *testing.T) {
+	settings.LoadForTest(t, "app:\n  require_caller_auth: no\nclients:\n  keyed:\n    api_key_hashes: [\"00\"]\n")
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/generate", CallerAuthentication(), func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%d", len(body))
+	})
+
+	tests := []struct {
+		name   string
+		client string
+		body   string
+		status int
+	}{
+		{"anonymous client", "open", `{"sub":"user"}`, http.StatusOK},
+		{"client with credentials", "keyed", `{"sub":"user"}`, http.StatusUnauthorized},
+		{"body at the limit", "open", strings.Repeat("a", maxCallerBodySize), http.StatusOK},
+		{"body too large", "open", strings.Repeat("a", maxCallerBodySize+1), http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(test.body))
+			r.Header.Set("Auth-Client", test.client)
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status %d, expected %d", w.Code, test.status)
+			}
+		})
+	}
+}
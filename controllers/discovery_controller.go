@@ -0,0 +1,41 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/fcoders/jwt-service/services/token"
+	"github.com/gin-gonic/gin"
+)
+
+// Discovery serves the OpenID Connect discovery document of the configured issuer
+func Discovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		response := token.Discovery()
+		if response.Status == http.StatusOK {
+			c.Header("Cache-Control", "public, max-age=3600")
+		}
+		response.Send(c.Writer)
+	}
+}
+
+// JWKS serves the public keys of the clients as a JSON Web Key Set
+func JWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		token.JWKS().Send(c.Writer)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiscoveryWithoutIssuer(t *testing.T) {
+	settings.LoadForTest(t, "app:\n  http_port: 0\n")
+	api.InitErrorMessages()
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/.well-known/openid-configuration", Discovery())
+
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	r.Host = "attacker.example.com"
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, expected %d", w.Code, http.StatusNotFound)
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "" {
+		t.Errorf("cached with %q", cacheControl)
+	}
+
+	var errData api.ErrorData
+	if err := json.Unmarshal(w.Body.Bytes(), &errData); err != nil || errData.Error != api.ErrorNotFound {
+		t.Errorf("body %q, expected a %s error", w.Body.String(), api.ErrorNotFound)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/fcoders/jwt-service/services/token"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Revoke handles RFC 7009 token revocation requests. Clients authenticate like
+// on the token endpoint.
+func Revoke() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiResponse := new(api.Response)
+		request := new(api.TokenHint)
+
+		if errBind := c.ShouldBindWith(request, binding.Form); errBind != nil {
+			apiResponse.Status = http.StatusBadRequest
+			apiResponse.ErrorCode = api.ErrorParsingRequest
+
+		} else if clientID, errResponse := authenticateClient(c); errResponse != nil {
+			apiResponse = errResponse
+
+		} else {
+			apiResponse = token.Revoke(c.Request.Context(), request, clientID)
+		}
+
+		apiResponse.Send(c.Writer)
+	}
+}
+
+// Token handles RFC 6749 token requests. Clients authenticate with their
+// secret or a signed assertion.
+func Token() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiResponse := new(api.Response)
+		request := new(api.TokenGrant)
+
+		if errBind := c.ShouldBindWith(request, binding.Form); errBind != nil {
+			apiResponse.Status = http.StatusBadRequest
+			apiResponse.ErrorCode = api.ErrorInvalidRequest
+
+		} else if clientID, errResponse := authenticateClient(c); errResponse != nil {
+			apiResponse = errResponse
+
+		} else {
+
+			switch request.GrantType {
+			case token.GrantClientCredentials:
+				apiResponse = token.IssueClientCredentials(c.Request.Context(), request, clientID, tlsConfirmation(c.Request), dpopProof(c.Request))
+
+			case token.GrantTokenExchange:
+				apiResponse = token.ExchangeToken(c.Request.Context(), request, clientID, tlsConfirmation(c.Request), dpopProof(c.Request))
+
+			default:
+				apiResponse.Status = http.StatusBadRequest
+				apiResponse.ErrorCode = api.ErrorUnsupportedGrantType
+			}
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("Pragma", "no-cache")
+		apiResponse.Send(c.Writer)
+	}
+}
+
+// authenticateClient identifies the OAuth client of the request, which form must
+// be already parsed. The response is set when the client cannot be authenticated.
+func authenticateClient(c *gin.Context) (clientID string, errResponse *api.Response) {
+	clientID, _, errAuth := clients.Authenticate(c.Request)
+	if errAuth != nil {
+		if c.Request.Header.Get("Authorization") != "" {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		errResponse = &api.Response{Status: http.StatusUnauthorized, ErrorCode: api.ErrorInvalidClient}
+	}
+
+	return
+}
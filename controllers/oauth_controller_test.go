@@ -0,0 +1,89 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestClientAuthenticationRequired(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.LoadForTest(t, fmt.Sprintf("clients:\n  test:\n    secret_hashes: [\"%s\"]\n", hash))
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/introspect", Introspect())
+	engine.POST("/revoke", Revoke())
+	engine.POST("/token", Token())
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		header       http.Header
+		basic        bool
+		authenticate bool
+	}{
+		{name: "no credentials", form: url.Values{"token": {"x"}}},
+		{name: "client header", form: url.Values{"token": {"x"}}, header: http.Header{"Auth-Client": {"test"}}},
+		{name: "client without secret", form: url.Values{"token": {"x"}, "client_id": {"test"}}},
+		{name: "wrong secret", form: url.Values{"token": {"x"}, "client_id": {"test"}, "client_secret": {"wrong"}}},
+		{name: "wrong basic secret", form: url.Values{"token": {"x"}}, basic: true, authenticate: true},
+	}
+
+	for _, path := range []string{"/introspect", "/revoke", "/token"} {
+		for _, test := range tests {
+			t.Run(path+" "+test.name, func(t *testing.T) {
+				form := test.form
+				if path == "/token" {
+					form = url.Values{"grant_type": {"client_credentials"}}
+					for k, v := range test.form {
+						form[k] = v
+					}
+				}
+
+				r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				for k, v := range test.header {
+					r.Header[k] = v
+				}
+				if test.basic {
+					r.SetBasicAuth("test", "wrong")
+				}
+
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, r)
+
+				if w.Code != http.StatusUnauthorized {
+					t.Errorf("status %d, expected %d", w.Code, http.StatusUnauthorized)
+				}
+				if challenge := w.Header().Get("WWW-Authenticate") != ""; challenge != test.authenticate {
+					t.Errorf("WWW-Authenticate sent: %v, expected %v", challenge, test.authenticate)
+				}
+			})
+		}
+	}
+}
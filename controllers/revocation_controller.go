@@ -0,0 +1,75 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/services/token"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamRevocations sends the revocations of the client's tokens as server-sent
+// events, so token consumers can drop revoked tokens immediately. The caller
+// must be authenticated for the client in the Auth-Client header.
+func StreamRevocations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		clientID := c.Request.Header.Get("Auth-Client")
+		if len(clientID) == 0 {
+			apiResponse := &api.Response{Status: http.StatusBadRequest, ErrorCode: api.ErrorInvalidClient}
+			apiResponse.Send(c.Writer)
+			return
+		}
+
+		events, stop, apiResponse := token.Revocations(clientID)
+		if apiResponse != nil {
+			apiResponse.Send(c.Writer)
+			return
+		}
+		defer stop()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+
+			case event, ok := <-events:
+				if !ok {
+					return false
+				}
+				c.SSEvent("revocation", event)
+
+			case now := <-heartbeat.C:
+				c.SSEvent("heartbeat", now.Unix())
+			}
+			return true
+		})
+	}
+}
@@ -17,10 +17,14 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/authentication"
 	"github.com/fcoders/jwt-service/services/token"
+	"github.com/fcoders/jwt-service/settings"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // Generate handles the requests to generate a new token
@@ -40,7 +44,7 @@ func Generate() gin.HandlerFunc {
 				apiResponse.Status = http.StatusBadRequest
 				apiResponse.ErrorCode = api.ErrorParsingRequest
 			} else {
-				apiResponse = token.Generate(request, clientID)
+				apiResponse = token.Generate(c.Request.Context(), request, clientID, tlsConfirmation(c.Request), dpopProof(c.Request))
 			}
 		}
 
@@ -66,7 +70,7 @@ func Validate() gin.HandlerFunc {
 				apiResponse.Status = http.StatusBadRequest
 				apiResponse.ErrorCode = api.ErrorParsingRequest
 			} else {
-				apiResponse = token.Validate(request, clientID)
+				apiResponse = token.Validate(c.Request.Context(), request, clientID)
 			}
 		}
 
@@ -92,10 +96,71 @@ func Destroy() gin.HandlerFunc {
 				apiResponse.Status = http.StatusBadRequest
 				apiResponse.ErrorCode = api.ErrorParsingRequest
 			} else {
-				apiResponse = token.Destroy(request, clientID)
+				apiResponse = token.Destroy(c.Request.Context(), request, clientID)
 			}
 		}
 
 		apiResponse.Send(c.Writer)
 	}
 }
+
+// Introspect handles RFC 7662 token introspection requests. Clients authenticate
+// like on the token endpoint.
+func Introspect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiResponse := new(api.Response)
+		request := new(api.TokenHint)
+
+		if errBind := c.ShouldBindWith(request, binding.Form); errBind != nil {
+			apiResponse.Status = http.StatusBadRequest
+			apiResponse.ErrorCode = api.ErrorParsingRequest
+
+		} else if clientID, errResponse := authenticateClient(c); errResponse != nil {
+			apiResponse = errResponse
+
+		} else {
+			apiResponse = token.Introspect(c.Request.Context(), request, clientID)
+		}
+
+		c.Header("Cache-Control", "no-store")
+		apiResponse.Send(c.Writer)
+	}
+}
+
+// tlsConfirmation returns the thumbprint of the TLS client certificate, so
+// tokens generated over mutual TLS are bound to it (RFC 8705)
+func tlsConfirmation(r *http.Request) *api.Confirmation {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return &api.Confirmation{CertificateThumbprint: authentication.CertificateThumbprint(r.TLS.PeerCertificates[0])}
+}
+
+// dpopProof returns the DPoP proof sent in the request headers, if any
+func dpopProof(r *http.Request) *api.DPoPProof {
+	proof := r.Header.Get("DPoP")
+	if proof == "" {
+		return nil
+	}
+	return &api.DPoPProof{Proof: proof, Method: r.Method, URL: requestURL(r)}
+}
+
+// requestURL returns the URL used by the client, based on the issuer when it
+// is configured, as the service can be behind a proxy
+func requestURL(r *http.Request) string {
+	return issuerURL(r) + r.URL.Path
+}
+
+// issuerURL returns the configured issuer, or the base URL of the request when
+// it is not set
+func issuerURL(r *http.Request) string {
+	if issuer := settings.Get().JWT.Issuer; issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit keeps an append-only trail of the tokens issued and revoked,
+// as JSON lines. Records can be hash-chained, each one including the hash of
+// the previous record, so changes to the trail are detected by Verify.
+// Tokens are identified by their SHA-256, the raw token is never written.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/fcoders/logger"
+)
+
+// Audited events
+const (
+	EventIssued    = "token.issued"
+	EventDestroyed = "token.destroyed"
+	EventRevoked   = "token.revoked"
+)
+
+// OutputStdout writes the records to the standard output
+const OutputStdout = "stdout"
+
+// Caller identifies who made the request
+type Caller struct {
+	Address     string `json:"address,omitempty"`
+	Certificate string `json:"certificate,omitempty"` // subject of the TLS client certificate
+}
+
+// Record is an entry of the audit trail
+type Record struct {
+	Seq         uint64  `json:"seq"`
+	Time        string  `json:"time"`
+	Event       string  `json:"event"`
+	Client      string  `json:"client"`
+	Caller      *Caller `json:"caller,omitempty"`
+	Subject     string  `json:"sub,omitempty"`
+	JTI         string  `json:"jti,omitempty"`
+	TokenSHA256 string  `json:"token_sha256,omitempty"`
+	ExpiresAt   int64   `json:"exp,omitempty"`
+	PrevHash    string  `json:"prev_hash,omitempty"`
+	Hash        string  `json:"hash,omitempty"`
+}
+
+type callerKey struct{}
+
+// WithCaller returns a copy of the context holding the caller of the request
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, &caller)
+}
+
+type trail struct {
+	sync.Mutex
+	output   io.Writer
+	file     *os.File
+	chained  bool
+	seq      uint64
+	lastHash string
+}
+
+var active *trail
+
+// Init opens the audit trail, when enabled. Hash-chained trails written to a
+// file continue the chain of the existing records.
+func Init() error {
+	conf := settings.Get().Audit
+	if !conf.Enabled {
+		return nil
+	}
+
+	t := &trail{chained: conf.HashChain}
+	if UsesStdout() {
+		t.output = os.Stdout
+	} else {
+		last, err := lastRecord(conf.Output)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			t.seq, t.lastHash = last.Seq, last.Hash
+		}
+
+		if t.file, err = os.OpenFile(conf.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+			return err
+		}
+		t.output = t.file
+	}
+
+	active = t
+	return nil
+}
+
+// UsesStdout returns true if the audit trail is written to the standard output
+func UsesStdout() bool {
+	conf := settings.Get().Audit
+	return conf.Enabled && (conf.Output == "" || conf.Output == OutputStdout)
+}
+
+// Close closes the audit trail, waiting for the record being written. Records
+// logged afterwards are dropped.
+func Close() {
+	t := active
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.output = nil
+}
+
+// TokenHash returns the identifier of the token in the audit trail
+func TokenHash(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// Log appends a record to the audit trail, taking the caller from the context
+func Log(ctx context.Context, record Record) {
+	t := active
+	if t == nil {
+		return
+	}
+
+	if caller, ok := ctx.Value(callerKey{}).(*Caller); ok {
+		record.Caller = caller
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.output == nil {
+		// closed
+		return
+	}
+
+	t.seq++
+	record.Seq = t.seq
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if t.chained {
+		record.PrevHash = t.lastHash
+		record.Hash = hash(record)
+	}
+
+	line, _ := json.Marshal(record)
+	if _, err := t.output.Write(append(line, '\n')); err != nil {
+		logger.GetLogger().Infof("Error writing audit record: %s", err)
+		return
+	}
+	t.lastHash = record.Hash
+}
+
+// hash returns the hash of the record, computed without its own hash
+func hash(record Record) string {
+	record.Hash = ""
+	content, _ := json.Marshal(record)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks the chain of hashes of the records read, returning the number
+// of records verified. The chain must start at the first record of the trail,
+// so the records verified are always the sequence numbers 1 to records.
+func Verify(r io.Reader) (records int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var previous *Record
+	for scanner.Scan() {
+		records++
+
+		record := new(Record)
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return records - 1, fmt.Errorf("Line %d: %s", records, err)
+		}
+
+		if record.Hash == "" || record.Hash != hash(*record) {
+			return records - 1, fmt.Errorf("Line %d: hash does not match the record", records)
+		}
+
+		if previous == nil {
+			if record.Seq != 1 || record.PrevHash != "" {
+				return records - 1, fmt.Errorf("Line %d: sequence %d does not start the trail", records, record.Seq)
+			}
+		} else {
+			if record.PrevHash != previous.Hash {
+				return records - 1, fmt.Errorf("Line %d: previous hash does not match line %d", records, records-1)
+			}
+			if record.Seq != previous.Seq+1 {
+				return records - 1, fmt.Errorf("Line %d: sequence %d follows %d", records, record.Seq, previous.Seq)
+			}
+		}
+
+		previous = record
+	}
+
+	return records, scanner.Err()
+}
+
+// lastRecord returns the last record in the file, nil if there is none
+func lastRecord(path string) (last *Record, err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var line []byte
+	for scanner.Scan() {
+		line = append(line[:0], scanner.Bytes()...)
+	}
+	if err = scanner.Err(); err != nil || len(line) == 0 {
+		return nil, err
+	}
+
+	last = new(Record)
+	if err = json.Unmarshal(line, last); err != nil {
+		return nil, fmt.Errorf("Cannot read the last audit record: %s", err)
+	}
+	return last, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// openTrail initializes a hash-chained trail written to the file
+func openTrail(t *testing.T, path string) {
+	t.Helper()
+
+	settings.LoadForTest(t, fmt.Sprintf("audit:\n  enabled: yes\n  output: %s\n  hash_chain: yes\n", path))
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Close)
+}
+
+func logRecords(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		Log(ctx, Record{Event: EventIssued, Client: "test", Subject: "user", TokenSHA256: TokenHash(fmt.Sprint(i))})
+	}
+}
+
+func TestHashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	openTrail(t, path)
+	logRecords(WithCaller(context.Background(), Caller{Address: "10.0.0.1"}), 3)
+	Close()
+
+	// the chain continues over the existing records
+	openTrail(t, path)
+	logRecords(context.Background(), 2)
+	Close()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err := Verify(bytes.NewReader(content)); err != nil || records != 5 {
+		t.Fatalf("%d records verified: %v", records, err)
+	}
+	if !strings.Contains(string(content), `"address":"10.0.0.1"`) {
+		t.Error("caller not recorded")
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	tests := []struct {
+		name     string
+		trail    string
+		verified int
+		valid    bool
+	}{
+		{"changed record", strings.Replace(string(content), `"sub":"user"`, `"sub":"other"`, 1), 0, false},
+		{"removed first record", lines[1] + lines[2] + lines[3] + lines[4], 0, false},
+		{"removed record", lines[0] + lines[2] + lines[3] + lines[4], 1, false},
+		{"reordered records", lines[0] + lines[2] + lines[1] + lines[3] + lines[4], 1, false},
+		{"not json", lines[0] + "record\n", 1, false},
+		{"truncated", lines[0] + lines[1], 2, true}, // tails are not detected
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := Verify(strings.NewReader(test.trail))
+			if valid := err == nil; valid != test.valid {
+				t.Errorf("valid = %v, expected %v: %v", valid, test.valid, err)
+			}
+			if records != test.verified {
+				t.Errorf("%d records verified, expected %d", records, test.verified)
+			}
+		})
+	}
+}
+
+func TestCloseWhileLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	openTrail(t, path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logRecords(context.Background(), 50)
+		}()
+	}
+	Close()
+	wg.Wait()
+
+	// records written before closing still form a chain
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := Verify(file); err != nil {
+		t.Error(err)
+	}
+}
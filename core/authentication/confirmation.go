@@ -0,0 +1,89 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+)
+
+// Confirmation methods in the cnf claim (RFC 7800)
+const (
+	ConfirmationClaim   = "cnf"
+	ConfirmationX5TS256 = "x5t#S256" // RFC 8705 certificate thumbprint
+	ConfirmationJKT     = "jkt"      // RFC 9449 DPoP key thumbprint
+)
+
+// CertificateThumbprint returns the base64url SHA-256 thumbprint of the certificate
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BindToken replaces any cnf claim in the request claims with the confirmation
+// of the proof-of-possession key. Binding only comes from verified sources, so
+// a cnf claim sent by the caller is always dropped.
+func BindToken(claims map[string]interface{}, confirmation *api.Confirmation) map[string]interface{} {
+	bound := make(map[string]interface{}, len(claims)+1)
+	for k, v := range claims {
+		if k != ConfirmationClaim {
+			bound[k] = v
+		}
+	}
+
+	if confirmation != nil {
+		cnf := make(map[string]interface{})
+		if confirmation.CertificateThumbprint != "" {
+			cnf[ConfirmationX5TS256] = confirmation.CertificateThumbprint
+		}
+		if confirmation.KeyThumbprint != "" {
+			cnf[ConfirmationJKT] = confirmation.KeyThumbprint
+		}
+
+		if len(cnf) > 0 {
+			bound[ConfirmationClaim] = cnf
+		}
+	}
+
+	return bound
+}
+
+// VerifyConfirmation checks the proof presented with the token matches the key
+// it is bound to. Tokens without a cnf claim are not bound to any key.
+func VerifyConfirmation(claims jwt.MapClaims, presented *api.Confirmation) bool {
+	cnf, ok := claims[ConfirmationClaim].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	if thumbprint, bound := cnf[ConfirmationX5TS256].(string); bound {
+		if presented == nil || subtle.ConstantTimeCompare([]byte(thumbprint), []byte(presented.CertificateThumbprint)) != 1 {
+			return false
+		}
+	}
+
+	if thumbprint, bound := cnf[ConfirmationJKT].(string); bound {
+		if presented == nil || subtle.ConstantTimeCompare([]byte(thumbprint), []byte(presented.KeyThumbprint)) != 1 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+)
+
+// clientCertificate creates a self-signed client certificate
+func clientCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// signedClaims returns the claims as read from a signed token, after the JSON
+// encoding
+func signedClaims(t *testing.T, claims map[string]interface{}) jwt.MapClaims {
+	t.Helper()
+
+	content, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := jwt.MapClaims{}
+	if err = json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestCertificateThumbprint(t *testing.T) {
+	cert := clientCertificate(t, "client")
+
+	sum := sha256.Sum256(cert.Raw)
+	if thumbprint := CertificateThumbprint(cert); thumbprint != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("thumbprint %s is not the base64url SHA-256 of the certificate", thumbprint)
+	}
+	if CertificateThumbprint(cert) == CertificateThumbprint(clientCertificate(t, "client")) {
+		t.Error("different certificates with the same thumbprint")
+	}
+}
+
+func TestBindToken(t *testing.T) {
+	certificate := CertificateThumbprint(clientCertificate(t, "client"))
+	key := "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+
+	tests := []struct {
+		name         string
+		claims       map[string]interface{}
+		confirmation *api.Confirmation
+		expected     map[string]interface{}
+	}{
+		{"not bound", map[string]interface{}{"sub": "user"}, nil, nil},
+		{"certificate", map[string]interface{}{"sub": "user"}, &api.Confirmation{CertificateThumbprint: certificate},
+			map[string]interface{}{ConfirmationX5TS256: certificate}},
+		{"DPoP key", map[string]interface{}{"sub": "user"}, &api.Confirmation{KeyThumbprint: key},
+			map[string]interface{}{ConfirmationJKT: key}},
+		{"certificate and DPoP key", map[string]interface{}{"sub": "user"}, &api.Confirmation{CertificateThumbprint: certificate, KeyThumbprint: key},
+			map[string]interface{}{ConfirmationX5TS256: certificate, ConfirmationJKT: key}},
+		{"caller cnf dropped", map[string]interface{}{"sub": "user", "cnf": map[string]interface{}{"jkt": "attacker"}}, nil, nil},
+		{"caller cnf replaced", map[string]interface{}{"sub": "user", "cnf": map[string]interface{}{"jkt": "attacker", "x5t#S256": "attacker"}},
+			&api.Confirmation{CertificateThumbprint: certificate}, map[string]interface{}{ConfirmationX5TS256: certificate}},
+		{"empty confirmation", map[string]interface{}{"sub": "user", "cnf": "attacker"}, &api.Confirmation{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bound := BindToken(test.claims, test.confirmation)
+
+			if bound["sub"] != "user" {
+				t.Errorf("claims %v not kept", bound)
+			}
+
+			cnf, exists := bound[ConfirmationClaim]
+			if test.expected == nil {
+				if exists {
+					t.Errorf("bound with %v", cnf)
+				}
+				return
+			}
+
+			confirmation, _ := cnf.(map[string]interface{})
+			if len(confirmation) != len(test.expected) {
+				t.Fatalf("cnf %v, expected %v", cnf, test.expected)
+			}
+			for method, thumbprint := range test.expected {
+				if confirmation[method] != thumbprint {
+					t.Errorf("cnf %v, expected %v", cnf, test.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyConfirmation(t *testing.T) {
+	certificate := CertificateThumbprint(clientCertificate(t, "client"))
+	other := CertificateThumbprint(clientCertificate(t, "other"))
+	key := "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+
+	tests := []struct {
+		name      string
+		bound     *api.Confirmation
+		presented *api.Confirmation
+		valid     bool
+	}{
+		{"not bound", nil, nil, true},
+		{"not bound with a certificate", nil, &api.Confirmation{CertificateThumbprint: certificate}, true},
+		{"certificate", &api.Confirmation{CertificateThumbprint: certificate}, &api.Confirmation{CertificateThumbprint: certificate}, true},
+		{"other certificate", &api.Confirmation{CertificateThumbprint: certificate}, &api.Confirmation{CertificateThumbprint: other}, false},
+		{"missing certificate", &api.Confirmation{CertificateThumbprint: certificate}, nil, false},
+		{"DPoP key instead of certificate", &api.Confirmation{CertificateThumbprint: certificate}, &api.Confirmation{KeyThumbprint: key}, false},
+		{"DPoP key", &api.Confirmation{KeyThumbprint: key}, &api.Confirmation{KeyThumbprint: key}, true},
+		{"certificate instead of DPoP key", &api.Confirmation{KeyThumbprint: key}, &api.Confirmation{CertificateThumbprint: certificate}, false},
+		{"certificate and DPoP key", &api.Confirmation{CertificateThumbprint: certificate, KeyThumbprint: key},
+			&api.Confirmation{CertificateThumbprint: certificate, KeyThumbprint: key}, true},
+		{"certificate without DPoP key", &api.Confirmation{CertificateThumbprint: certificate, KeyThumbprint: key},
+			&api.Confirmation{CertificateThumbprint: certificate}, false},
+		{"DPoP key without certificate", &api.Confirmation{CertificateThumbprint: certificate, KeyThumbprint: key},
+			&api.Confirmation{KeyThumbprint: key}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := signedClaims(t, BindToken(map[string]interface{}{"sub": "user"}, test.bound))
+			if valid := VerifyConfirmation(claims, test.presented); valid != test.valid {
+				t.Errorf("valid = %v, expected %v", valid, test.valid)
+			}
+		})
+	}
+}
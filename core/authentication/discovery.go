@@ -0,0 +1,54 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"sort"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// SigningAlgorithm is the algorithm used to sign the tokens
+var SigningAlgorithm = jwt.SigningMethodRS512
+
+// keyID returns the RFC 7638 thumbprint of the public key, used as kid
+func keyID(publicKey *rsa.PublicKey) string {
+	thumbprint, err := (&jose.JSONWebKey{Key: publicKey}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+// JWKS returns the public keys verifying the tokens of every client, sorted by kid
+func (backend *JWTAuthenticationBackendKeys) JWKS() jose.JSONWebKeySet {
+	jwks := jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, 0, len(backend.Store))}
+
+	for _, ks := range backend.Store {
+		jwks.Keys = append(jwks.Keys, jose.JSONWebKey{
+			Key:       ks.PublicKey,
+			KeyID:     ks.KeyID,
+			Algorithm: SigningAlgorithm.Alg(),
+			Use:       "sig",
+		})
+	}
+
+	sort.Slice(jwks.Keys, func(i, k int) bool { return jwks.Keys[i].KeyID < jwks.Keys[k].KeyID })
+	return jwks
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/settings"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	dpopType          = "dpop+jwt"
+	defaultDPoPMaxAge = 60 * time.Second
+	dpopClockSkew     = 5 * time.Second
+	dpopReplayPrefix  = "dpop:"
+)
+
+// ErrInvalidDPoPProof is returned when a DPoP proof cannot be verified
+var ErrInvalidDPoPProof = errors.New("Invalid DPoP proof")
+
+// VerifyDPoPProof verifies a RFC 9449 proof created for the HTTP method and URL.
+// When accessToken is not empty, the proof must include its hash. Every proof
+// is accepted only once. It returns the thumbprint of the proof key.
+func (backend *JWTAuthenticationBackendKeys) VerifyDPoPProof(ctx context.Context, proof string, method string, uri string, accessToken string) (jkt string, err error) {
+
+	var jwk jose.JSONWebKey
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	_, errParse := parser.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != dpopType {
+			return nil, fmt.Errorf("Unexpected proof type: %v", token.Header["typ"])
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		header, _ := json.Marshal(token.Header["jwk"])
+		if errKey := jwk.UnmarshalJSON(header); errKey != nil || !jwk.Valid() || !jwk.IsPublic() {
+			return nil, fmt.Errorf("Invalid proof key")
+		}
+
+		return jwk.Key, nil
+	})
+
+	if errParse != nil {
+		return "", ErrInvalidDPoPProof
+	}
+
+	maxAge := defaultDPoPMaxAge
+	if seconds := settings.Get().JWT.DPoPMaxAge; seconds > 0 {
+		maxAge = time.Duration(seconds) * time.Second
+	}
+
+	iat, _ := claims["iat"].(float64)
+	age := time.Since(time.Unix(int64(iat), 0))
+	if iat == 0 || age > maxAge || age < -dpopClockSkew {
+		return "", ErrInvalidDPoPProof
+	}
+
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	if htm == "" || htm != method || !sameURI(htu, uri) {
+		return "", ErrInvalidDPoPProof
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims["ath"] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", ErrInvalidDPoPProof
+		}
+	}
+
+	thumbprint, errThumbprint := jwk.Thumbprint(crypto.SHA256)
+	if errThumbprint != nil {
+		return "", ErrInvalidDPoPProof
+	}
+	jkt = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	// proofs can't be replayed while they are accepted
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", ErrInvalidDPoPProof
+	}
+
+	ctx, cancel := cacheContext(ctx)
+	defer cancel()
+
+	first, errCache := tokenCache.SetIfNotExists(ctx, dpopReplayPrefix+jkt+":"+jti, "1", maxAge+dpopClockSkew)
+	if errCache != nil {
+		return "", errCache
+	}
+
+	if !first {
+		return "", ErrInvalidDPoPProof
+	}
+
+	return jkt, nil
+}
+
+// sameURI compares two absolute URIs ignoring the query and fragment, as
+// required for htu
+func sameURI(a string, b string) bool {
+	urlA, errA := url.Parse(a)
+	urlB, errB := url.Parse(b)
+	if errA != nil || errB != nil || !urlA.IsAbs() || urlA.Host == "" || !urlB.IsAbs() || urlB.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(urlA.Scheme, urlB.Scheme) &&
+		strings.EqualFold(urlA.Host, urlB.Host) &&
+		urlA.Path == urlB.Path
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/core/cache/memory"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/google/uuid"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	testHTU         = "https://auth.example.com/v1/token/validate"
+	testAccessToken = "access-token"
+)
+
+// dpopProof signs a proof with the key, using the given header and claims on
+// top of a valid proof for POST testHTU
+func dpopProof(t *testing.T, key *ecdsa.PrivateKey, header map[string]interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(testAccessToken))
+	proofClaims := jwt.MapClaims{
+		"htm": "POST",
+		"htu": testHTU,
+		"iat": time.Now().Unix(),
+		"jti": uuid.New().String(),
+		"ath": base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(proofClaims, k)
+		} else {
+			proofClaims[k] = v
+		}
+	}
+
+	jwk, err := json.Marshal(jose.JSONWebKey{Key: &key.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, proofClaims)
+	token.Header["typ"] = dpopType
+	token.Header["jwk"] = json.RawMessage(jwk)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	settings.LoadForTest(t, "jwt:\n  dpop_max_age: 60\n")
+	tokenCache = new(memory.Cache)
+	tokenCache.Init()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, _ := (&jose.JSONWebKey{Key: &key.PublicKey}).Thumbprint(crypto.SHA256)
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	replayed := dpopProof(t, key, nil, nil)
+
+	tests := []struct {
+		name        string
+		proof       string
+		method      string
+		uri         string
+		accessToken string
+		valid       bool
+	}{
+		{name: "valid", proof: dpopProof(t, key, nil, nil), method: "POST", uri: testHTU, accessToken: testAccessToken, valid: true},
+		{name: "without access token", proof: dpopProof(t, key, nil, jwt.MapClaims{"ath": nil}), method: "POST", uri: testHTU, valid: true},
+		{name: "query ignored", proof: dpopProof(t, key, nil, jwt.MapClaims{"htu": testHTU + "?a=1"}), method: "POST", uri: testHTU, valid: true},
+		{name: "host case ignored", proof: dpopProof(t, key, nil, jwt.MapClaims{"htu": "https://AUTH.example.com/v1/token/validate"}), method: "POST", uri: testHTU, valid: true},
+		{name: "replay (first use)", proof: replayed, method: "POST", uri: testHTU, accessToken: testAccessToken, valid: true},
+		{name: "replay", proof: replayed, method: "POST", uri: testHTU, accessToken: testAccessToken},
+		{name: "other method", proof: dpopProof(t, key, nil, nil), method: "GET", uri: testHTU},
+		{name: "other uri", proof: dpopProof(t, key, nil, nil), method: "POST", uri: "https://auth.example.com/oauth/token"},
+		{name: "empty htm and method", proof: dpopProof(t, key, nil, jwt.MapClaims{"htm": ""}), method: "", uri: testHTU},
+		{name: "missing htm and method", proof: dpopProof(t, key, nil, jwt.MapClaims{"htm": nil}), method: "", uri: testHTU},
+		{name: "empty htu and uri", proof: dpopProof(t, key, nil, jwt.MapClaims{"htu": ""}), method: "POST", uri: ""},
+		{name: "missing htu and uri", proof: dpopProof(t, key, nil, jwt.MapClaims{"htu": nil}), method: "POST", uri: ""},
+		{name: "relative htu", proof: dpopProof(t, key, nil, jwt.MapClaims{"htu": "/v1/token/validate"}), method: "POST", uri: "/v1/token/validate"},
+		{name: "other access token", proof: dpopProof(t, key, nil, nil), method: "POST", uri: testHTU, accessToken: "other"},
+		{name: "old", proof: dpopProof(t, key, nil, jwt.MapClaims{"iat": time.Now().Add(-2 * time.Minute).Unix()}), method: "POST", uri: testHTU},
+		{name: "future", proof: dpopProof(t, key, nil, jwt.MapClaims{"iat": time.Now().Add(time.Minute).Unix()}), method: "POST", uri: testHTU},
+		{name: "without iat", proof: dpopProof(t, key, nil, jwt.MapClaims{"iat": nil}), method: "POST", uri: testHTU},
+		{name: "without jti", proof: dpopProof(t, key, nil, jwt.MapClaims{"jti": nil}), method: "POST", uri: testHTU},
+		{name: "type", proof: dpopProof(t, key, map[string]interface{}{"typ": "JWT"}, nil), method: "POST", uri: testHTU},
+		{name: "without key", proof: dpopProof(t, key, map[string]interface{}{"jwk": nil}, nil), method: "POST", uri: testHTU},
+		{name: "not a jwt", proof: "proof", method: "POST", uri: testHTU},
+	}
+
+	backend := new(JWTAuthenticationBackendKeys)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			thumbprint, err := backend.VerifyDPoPProof(context.Background(), test.proof, test.method, test.uri, test.accessToken)
+			if !test.valid {
+				if err != ErrInvalidDPoPProof {
+					t.Errorf("got %v, expected %v", err, ErrInvalidDPoPProof)
+				}
+				return
+			}
+
+			if err != nil || thumbprint != jkt {
+				t.Errorf("got %q, %v, expected %q", thumbprint, err, jkt)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/fcoders/jwt-service/settings"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// ContentEncryption is the algorithm encrypting the content of the tokens
+const ContentEncryption = jose.A256GCM
+
+// isEncrypted returns true if the token uses the JWE compact serialization
+func isEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// LoadEncryptionKey loads the private key used to decrypt the tokens of the
+// client. The public key, used to encrypt them, is derived from it.
+func (ks *KeyStore) LoadEncryptionKey(path string) (err error) {
+	block, errRead := readPEM(path)
+	if errRead != nil {
+		return errRead
+	}
+
+	var key interface{}
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+				return fmt.Errorf("Error parsing encryption key: %s", err)
+			}
+		}
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		ks.DecryptionKey, ks.EncryptionKey = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		ks.DecryptionKey, ks.EncryptionKey = k, &k.PublicKey
+	default:
+		return fmt.Errorf("Encryption key must be RSA or EC")
+	}
+
+	return nil
+}
+
+// LoadEncryptionPublicKey loads the public key of a recipient that decrypts the
+// tokens on its own. Tokens encrypted with it cannot be parsed by this service.
+func (ks *KeyStore) LoadEncryptionPublicKey(path string) (err error) {
+	block, errRead := readPEM(path)
+	if errRead != nil {
+		return errRead
+	}
+
+	key, errParse := x509.ParsePKIXPublicKey(block.Bytes)
+	if errParse != nil {
+		return fmt.Errorf("Error parsing encryption public key: %s", errParse)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		ks.EncryptionKey = key
+	default:
+		return fmt.Errorf("Encryption public key must be RSA or EC")
+	}
+
+	return nil
+}
+
+// checkEncryption verifies the client has a key to encrypt its tokens, when
+// they must be encrypted
+func (ks *KeyStore) checkEncryption() error {
+	if settings.GetClient(ks.ID).EncryptTokens && ks.EncryptionKey == nil {
+		return fmt.Errorf("Client %s encrypts its tokens but has no enc.key or enc.pub file", ks.ID)
+	}
+	return nil
+}
+
+// keyAlgorithm returns the algorithm wrapping the content key for the key:
+// RSA-OAEP-256 for RSA keys, and ECDH-ES for EC keys
+func keyAlgorithm(key interface{}) (algorithm jose.KeyAlgorithm, supported bool) {
+	switch key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return jose.RSA_OAEP_256, true
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return jose.ECDH_ES, true
+	}
+	return "", false
+}
+
+// encrypt wraps the signed token in a JWE, using RSA-OAEP-256 or ECDH-ES
+// depending on the recipient key, and A256GCM for the content
+func (ks *KeyStore) encrypt(signedToken string) (string, error) {
+	algorithm, supported := keyAlgorithm(ks.EncryptionKey)
+	if !supported {
+		return "", fmt.Errorf("No encryption key defined for client ID %s", ks.ID)
+	}
+	recipient := jose.Recipient{Algorithm: algorithm, Key: ks.EncryptionKey}
+
+	encrypter, err := jose.NewEncrypter(ContentEncryption, recipient, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+	if err != nil {
+		return "", err
+	}
+
+	jwe, err := encrypter.Encrypt([]byte(signedToken))
+	if err != nil {
+		return "", err
+	}
+
+	return jwe.CompactSerialize()
+}
+
+// decrypt returns the signed token wrapped in the JWE. Only the algorithms
+// used to encrypt the tokens are accepted.
+func (ks *KeyStore) decrypt(encryptedToken string) (string, error) {
+	algorithm, supported := keyAlgorithm(ks.DecryptionKey)
+	if !supported {
+		return "", fmt.Errorf("No decryption key defined for client ID %s", ks.ID)
+	}
+
+	jwe, err := jose.ParseEncrypted(encryptedToken)
+	if err != nil {
+		return "", err
+	}
+
+	if jwe.Header.Algorithm != string(algorithm) {
+		return "", fmt.Errorf("Unexpected key algorithm %s", jwe.Header.Algorithm)
+	}
+	if enc, _ := jwe.Header.ExtraHeaders["enc"].(string); enc != string(ContentEncryption) {
+		return "", fmt.Errorf("Unexpected content encryption %s", enc)
+	}
+
+	signedToken, err := jwe.Decrypt(ks.DecryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(signedToken), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening key file: %s", err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data found in %s", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/fcoders/logger"
+	"golang.org/x/sync/singleflight"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	defaultJWKSCacheTTL = time.Hour
+
+	// minimum time between fetches triggered by unknown key IDs, so tokens
+	// with random kid values cannot flood the issuer
+	jwksRefetchInterval = 30 * time.Second
+
+	maxJWKSSize      = 1 << 20
+	jwksFetchTimeout = 5 * time.Second
+)
+
+// remote key sets, by JWKS URL
+var jwksCache = struct {
+	sync.Mutex
+	sets map[string]*remoteKeySet
+}{sets: make(map[string]*remoteKeySet)}
+
+// fetches in progress, by JWKS URL, so concurrent requests wait for the same one
+var jwksFetches singleflight.Group
+
+// remoteKeySet holds the keys published by an external issuer
+type remoteKeySet struct {
+	sync.Mutex
+	url       string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	checkedAt time.Time // last fetch attempt
+	fetchErr  error     // of the last fetch attempt
+}
+
+// trustedIssuerKey returns the key verifying a token from an issuer trusted
+// by the client
+func trustedIssuerKey(issuer *settings.TrustedIssuer, token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if issuer.Audience != "" && !clients.HasAudience(claims, issuer.Audience) {
+		return nil, fmt.Errorf("Token audience not accepted for issuer %s", issuer.Issuer)
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	ttl := defaultJWKSCacheTTL
+	if issuer.CacheTTL > 0 {
+		ttl = time.Duration(issuer.CacheTTL) * time.Second
+	}
+
+	return getRemoteKeySet(issuer.JWKSURL).key(kid, ttl)
+}
+
+func getRemoteKeySet(url string) *remoteKeySet {
+	jwksCache.Lock()
+	defer jwksCache.Unlock()
+
+	set, exists := jwksCache.sets[url]
+	if !exists {
+		set = &remoteKeySet{url: url}
+		jwksCache.sets[url] = set
+	}
+	return set
+}
+
+// key returns the key identified by kid, fetching the key set when it expired
+// or the key is unknown. Tokens without kid are accepted when the set holds a
+// single key. The lock is not held while fetching, so the cached keys can be
+// used meanwhile. Fetches are throttled even while no keys could be fetched.
+func (s *remoteKeySet) key(kid string, ttl time.Duration) (interface{}, error) {
+	s.Lock()
+	_, known := s.find(kid)
+	expired := time.Since(s.fetchedAt) > ttl
+	refetch := (s.keys == nil || expired || !known) && time.Since(s.checkedAt) > jwksRefetchInterval
+	if !refetch && s.keys == nil {
+		defer s.Unlock()
+		return nil, s.fetchErr
+	}
+	s.Unlock()
+
+	if refetch {
+		_, err, _ := jwksFetches.Do(s.url, func() (interface{}, error) {
+			return nil, s.refresh()
+		})
+
+		s.Lock()
+		cached := s.keys != nil
+		s.Unlock()
+
+		// keep using the cached keys while the issuer is unavailable
+		if err != nil && !cached {
+			return nil, err
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if key, exists := s.find(kid); exists {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown key %q in %s", kid, s.url)
+}
+
+// refresh replaces the keys with the ones fetched from the issuer
+func (s *remoteKeySet) refresh() error {
+	s.Lock()
+	if time.Since(s.checkedAt) <= jwksRefetchInterval {
+		// fetched by a concurrent request since the keys were checked
+		defer s.Unlock()
+		return s.fetchErr
+	}
+	s.checkedAt = time.Now()
+	s.Unlock()
+
+	keys, err := fetchJWKS(s.url)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.fetchErr = err
+	if err != nil {
+		if s.keys != nil {
+			logger.GetLogger().Infof("%s", err)
+		}
+		return err
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (s *remoteKeySet) find(kid string) (key interface{}, exists bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key = range s.keys {
+			return key, true
+		}
+	}
+	key, exists = s.keys[kid]
+	return
+}
+
+// fetchJWKS loads the signing keys of the JWKS, by key ID
+func fetchJWKS(url string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching JWKS from %s: %s", url, err)
+	}
+
+	client := *settings.GetHTTPClient()
+	client.Timeout = jwksFetchTimeout
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching JWKS from %s: %s", url, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error fetching JWKS from %s: status %d", url, response.StatusCode)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err = json.NewDecoder(io.LimitReader(response.Body, maxJWKSSize)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("Error parsing JWKS from %s: %s", url, err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for i := range jwks.Keys {
+		if jwks.Keys[i].Use != "" && jwks.Keys[i].Use != "sig" {
+			continue
+		}
+		keys[jwks.Keys[i].KeyID] = jwks.Keys[i].Public().Key
+	}
+
+	return keys, nil
+}
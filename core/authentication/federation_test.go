@@ -0,0 +1,248 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/settings"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const testExternalIssuer = "https://idp.example.com"
+
+// jwksServer is a JWKS endpoint stub, counting the requests received
+type jwksServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	requests int32
+	failing  int32
+	release  chan struct{} // when set, responses wait until it's closed
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &jwksServer{key: key}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&stub.requests, 1)
+		if stub.release != nil {
+			<-stub.release
+		}
+
+		if atomic.LoadInt32(&stub.failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "sig", Algorithm: "RS256", Use: "sig"},
+			{Key: &key.PublicKey, KeyID: "enc", Algorithm: "RSA-OAEP", Use: "enc"},
+		}})
+	}))
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *jwksServer) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	var key interface{} = s.key
+	if method == jwt.SigningMethodHS256 {
+		key = []byte("secret")
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestTrustedIssuer(t *testing.T) {
+	stub := newJWKSServer(t)
+	settings.LoadForTest(t, fmt.Sprintf(`
+clients:
+  test:
+    trusted_issuers:
+      - issuer: %s
+        jwks_uri: %s
+        audience: orders
+`, testExternalIssuer, stub.URL))
+
+	exp := time.Now().Add(time.Minute).Unix()
+	claims := func(iss string, aud string) jwt.MapClaims {
+		return jwt.MapClaims{"iss": iss, "aud": aud, "sub": "user", "exp": exp}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"trusted", stub.sign(t, jwt.SigningMethodRS256, "sig", claims(testExternalIssuer, "orders")), true},
+		{"other audience", stub.sign(t, jwt.SigningMethodRS256, "sig", claims(testExternalIssuer, "billing")), false},
+		{"unknown key", stub.sign(t, jwt.SigningMethodRS256, "other", claims(testExternalIssuer, "orders")), false},
+		{"encryption key", stub.sign(t, jwt.SigningMethodRS256, "enc", claims(testExternalIssuer, "orders")), false},
+		{"symmetric", stub.sign(t, jwt.SigningMethodHS256, "sig", claims(testExternalIssuer, "orders")), false},
+		{"untrusted issuer", stub.sign(t, jwt.SigningMethodRS256, "sig", claims("https://other.example.com", "orders")), false},
+	}
+
+	backend := new(JWTAuthenticationBackendKeys)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := jwt.Parse(test.token, backend.KeyFunc("test"))
+			if valid := err == nil && token.Valid; valid != test.valid {
+				t.Errorf("valid = %v, expected %v: %v", valid, test.valid, err)
+			}
+		})
+	}
+
+	// unknown keys don't trigger fetches within the refetch interval
+	if requests := atomic.LoadInt32(&stub.requests); requests != 1 {
+		t.Errorf("%d JWKS requests, expected 1", requests)
+	}
+}
+
+func TestRemoteKeySetRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		cached    bool
+		expired   bool
+		failedAgo time.Duration // since a failed fetch, without keys cached
+		failing   bool
+		requests  int32
+		available bool
+	}{
+		{name: "first fetch", requests: 1, available: true},
+		{name: "first fetch failing", failing: true, requests: 1},
+		{name: "failed recently", failedAgo: time.Second},
+		{name: "failed before the refetch interval", failedAgo: 2 * jwksRefetchInterval, requests: 1, available: true},
+		{name: "cached", cached: true, available: true},
+		{name: "expired", cached: true, expired: true, requests: 1, available: true},
+		{name: "expired while failing", cached: true, expired: true, failing: true, requests: 1, available: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := newJWKSServer(t)
+			settings.LoadForTest(t, "app:\n  http_port: 0\n")
+
+			set := &remoteKeySet{url: stub.URL}
+			if test.cached {
+				set.keys = map[string]interface{}{"sig": &stub.key.PublicKey}
+				set.fetchedAt = time.Now()
+				set.checkedAt = set.fetchedAt
+			}
+			if test.expired {
+				set.fetchedAt = time.Now().Add(-2 * time.Hour)
+				set.checkedAt = set.fetchedAt
+			}
+			if test.failedAgo > 0 {
+				set.checkedAt = time.Now().Add(-test.failedAgo)
+				set.fetchErr = fmt.Errorf("JWKS not available")
+			}
+			if test.failing {
+				stub.failing = 1
+			}
+
+			key, err := set.key("sig", time.Hour)
+			if available := err == nil && key != nil; available != test.available {
+				t.Errorf("key available = %v, expected %v: %v", available, test.available, err)
+			}
+			if requests := atomic.LoadInt32(&stub.requests); requests != test.requests {
+				t.Errorf("%d JWKS requests, expected %d", requests, test.requests)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetFailureThrottled(t *testing.T) {
+	stub := newJWKSServer(t)
+	stub.failing = 1
+	settings.LoadForTest(t, "app:\n  http_port: 0\n")
+
+	// an issuer down is not requested again on every token
+	set := &remoteKeySet{url: stub.URL}
+	for i := 0; i < 3; i++ {
+		if _, err := set.key("sig", time.Hour); err == nil {
+			t.Fatal("key available")
+		}
+	}
+	if requests := atomic.LoadInt32(&stub.requests); requests != 1 {
+		t.Errorf("%d JWKS requests, expected 1", requests)
+	}
+}
+
+func TestRemoteKeySetConcurrentFetch(t *testing.T) {
+	stub := newJWKSServer(t)
+	stub.release = make(chan struct{})
+	settings.LoadForTest(t, "app:\n  http_port: 0\n")
+
+	set := &remoteKeySet{url: stub.URL}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := set.key("sig", time.Hour)
+			errs <- err
+		}()
+	}
+
+	// the lock is not held while the issuer answers
+	for atomic.LoadInt32(&stub.requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	set.Lock()
+	set.Unlock()
+
+	close(stub.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if requests := atomic.LoadInt32(&stub.requests); requests != 1 {
+		t.Errorf("%d JWKS requests, expected 1", requests)
+	}
+}
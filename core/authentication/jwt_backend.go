@@ -2,8 +2,10 @@ package authentication
 
 import (
 	"bufio"
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -11,22 +13,43 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/fcoders/jwt-service/api"
 	"github.com/fcoders/jwt-service/common"
+	"github.com/fcoders/jwt-service/core/audit"
 	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/jwt-service/core/cache/memory"
+	"github.com/fcoders/jwt-service/core/enrichment"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/core/webhooks"
 	"github.com/fcoders/jwt-service/settings"
+	"github.com/fcoders/logger"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
 const (
 	expireOffset = 60 // indicates how is the expiration time represented (60=minutes, 3600=hours, etc)
+
+	// deadline of the cache operations when redis.timeouts.operation is not configured
+	defaultOperationTimeout = time.Second
 )
 
 var authBackendInstance *JWTAuthenticationBackendKeys
+var backendOnce sync.Once
+var backendErr error
 var tokenCache cache.Connector
 
+// revocations known by this instance, used when the cache cannot be reached
+var localBlacklist cache.Connector
+
+// in-process front for blacklist lookups, nil when the cache is not shared or
+// neither the filter nor the local blacklist need it
+var revocations *revocationFilter
+
 // JWTAuthenticationBackendKeys hols the keys used for signing the token
 type JWTAuthenticationBackendKeys struct {
 	Store map[string]*KeyStore
@@ -40,15 +63,45 @@ func (backend *JWTAuthenticationBackendKeys) GetStore(id string) (ks *KeyStore,
 	return
 }
 
-// ParseToken parse the string with the token and returns a jwt.Token
+// ParseToken parse the string with the token and returns a jwt.Token.
+// Encrypted tokens are decrypted before verifying them, keeping the encrypted
+// form as the raw token.
 func (backend *JWTAuthenticationBackendKeys) ParseToken(token string, id string) (*jwt.Token, error) {
-	return jwt.Parse(token, backend.KeyFunc(id))
+	signedToken := token
+
+	if isEncrypted(token) {
+		ks, exists := backend.GetStore(id)
+		if !exists {
+			return nil, fmt.Errorf("No keys defined for client ID %s", id)
+		}
+
+		decrypted, err := ks.decrypt(token)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting token: %s", err)
+		}
+		signedToken = decrypted
+	}
+
+	parsed, err := jwt.Parse(signedToken, backend.KeyFunc(id))
+	if parsed != nil {
+		parsed.Raw = token
+	}
+
+	return parsed, err
 }
 
-// KeyFunc is a function used to validate the algorithm and extract the token from the request
+// KeyFunc is a function used to validate the algorithm and extract the token from the request.
+// Tokens from an issuer trusted by the client are verified with the issuer's JWKS.
 func (backend *JWTAuthenticationBackendKeys) KeyFunc(id string) jwt.Keyfunc {
 	return func(token *jwt.Token) (i interface{}, err error) {
 
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			iss, _ := claims["iss"].(string)
+			if issuer, trusted := settings.GetClient(id).GetTrustedIssuer(iss); trusted {
+				return trustedIssuerKey(issuer, token)
+			}
+		}
+
 		// validate the alg
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
@@ -66,8 +119,14 @@ func (backend *JWTAuthenticationBackendKeys) KeyFunc(id string) jwt.Keyfunc {
 // KeyStore represents an in memory store for private/public keys
 type KeyStore struct {
 	ID         string
+	KeyID      string // kid of the tokens, the thumbprint of the public key
 	PrivateKey *rsa.PrivateKey
 	PublicKey  *rsa.PublicKey
+	ModTime    time.Time // of the private key file
+
+	// optional keys used to wrap the tokens in a JWE
+	EncryptionKey interface{}
+	DecryptionKey interface{}
 }
 
 // IsLoaded returns true if private and public keys are loaded correcrtly
@@ -133,40 +192,63 @@ func (ks *KeyStore) LoadPublicKey(path string) (err error) {
 	return
 }
 
-// InitJWTAuthenticationBackend initializes the JWT auth system with the keys
-func InitJWTAuthenticationBackend(cacheConnector cache.Connector) (bk *JWTAuthenticationBackendKeys, err error) {
-	if authBackendInstance == nil {
-		authBackendInstance = new(JWTAuthenticationBackendKeys)
+// InitJWTAuthenticationBackend initializes the JWT auth system with the keys.
+// It's initialized only once, later calls return the same instance or error.
+func InitJWTAuthenticationBackend(cacheConnector cache.Connector) (*JWTAuthenticationBackendKeys, error) {
+	backendOnce.Do(func() {
+		authBackendInstance, backendErr = newJWTAuthenticationBackend(cacheConnector)
+	})
 
-		// load store
-		store, errStore := loadKeyStores()
-		if errStore != nil {
-			err = errStore
-			return
-		}
+	return authBackendInstance, backendErr
+}
+
+// newJWTAuthenticationBackend loads the keys and starts the cache
+func newJWTAuthenticationBackend(cacheConnector cache.Connector) (backend *JWTAuthenticationBackendKeys, err error) {
+	backend = new(JWTAuthenticationBackendKeys)
+
+	// load store
+	store, errStore := loadKeyStores()
+	if errStore != nil {
+		return nil, errStore
+	}
 
-		authBackendInstance.Store = store
+	backend.Store = store
 
-		// Start connections with Redis server
-		conf := settings.Get().Redis
-		tokenCache = cacheConnector
-		tokenCache.Init(conf.Address, conf.Password)
+	// Start connections with Redis server
+	if errCache := cacheConnector.Init(); errCache != nil {
+		return nil, fmt.Errorf("Cannot initialize cache: %s", errCache)
 	}
 
-	return authBackendInstance, nil
+	localBlacklist = new(memory.Cache)
+	localBlacklist.Init()
+
+	if errFilter := initRevocationFilter(cacheConnector); errFilter != nil {
+		return nil, errFilter
+	}
+
+	if errMetrics := metrics.Register(keyStoreCollector{backend}); errMetrics != nil {
+		logger.GetLogger().Infof("Cannot register key store metrics: %s", errMetrics)
+	}
+
+	tokenCache = cacheConnector
+	return backend, nil
 }
 
 // GenerateToken generates a new token for the user.
 // Parameter id represents the user ID or subject and grant represent the token type generated
 // (currently only 'access_token' supported)
-func (backend *JWTAuthenticationBackendKeys) GenerateToken(requestClaims map[string]interface{}, id string) (tokenString string, expiresIn int, err error) {
+func (backend *JWTAuthenticationBackendKeys) GenerateToken(ctx context.Context, requestClaims map[string]interface{}, id string) (tokenString string, expiresIn int, err error) {
 
-	token := jwt.New(jwt.SigningMethodRS512)
+	token := jwt.New(SigningAlgorithm)
 	claims := token.Claims.(jwt.MapClaims)
 	now := time.Now()
 
 	claims["exp"] = now.Add(time.Minute * time.Duration(settings.Get().JWT.TokenExpiration)).Unix()
 	claims["iat"] = now.Unix()
+	claims["jti"] = uuid.New().String()
+	if issuer := settings.Get().JWT.Issuer; issuer != "" {
+		claims["iss"] = strings.TrimSuffix(issuer, "/")
+	}
 
 	for k, v := range requestClaims {
 
@@ -181,16 +263,59 @@ func (backend *JWTAuthenticationBackendKeys) GenerateToken(requestClaims map[str
 		}
 	}
 
+	// claims from the user directory of the client
+	sub, _ := claims["sub"].(string)
+	enriched, errEnrich := enrichment.Claims(ctx, id, sub)
+	if errEnrich != nil {
+		if settings.GetClient(id).Enrichment.Required {
+			err = fmt.Errorf("Error looking up claims of %s: %s", sub, errEnrich)
+			return
+		}
+		logger.GetLogger().Infof("Error looking up claims of %s for client %s: %s", sub, id, errEnrich)
+	}
+	for k, v := range enriched {
+		claims[k] = v
+	}
+
 	token.Claims = claims
 
 	if store, exists := backend.GetStore(id); exists {
 
+		token.Header["kid"] = store.KeyID
 		tokenString, err = token.SignedString(store.PrivateKey)
 		if err != nil {
 			log.Fatalf("Error signing the token: %s", err.Error())
 		}
 
+		if settings.GetClient(id).EncryptTokens {
+			if tokenString, err = store.encrypt(tokenString); err != nil {
+				return
+			}
+		}
+
+		jti, _ := claims["jti"].(string)
+		exp, isSet := claims["exp"].(int64)
+		if !isSet {
+			// overridden by the request claims
+			if f, ok := claims["exp"].(float64); ok {
+				exp = int64(f)
+			}
+		}
+
 		expiresIn = settings.Get().JWT.TokenExpiration * 60
+		if exp != 0 {
+			expiresIn = int(exp - now.Unix())
+		}
+
+		webhooks.Notify(api.LifecycleEvent{Type: webhooks.EventGenerated, Client: id, Subject: sub, JTI: jti})
+		audit.Log(ctx, audit.Record{
+			Event:       audit.EventIssued,
+			Client:      id,
+			Subject:     sub,
+			JTI:         jti,
+			TokenSHA256: audit.TokenHash(tokenString),
+			ExpiresAt:   exp,
+		})
 	} else {
 		err = fmt.Errorf("No keys defined for client ID %s", id)
 	}
@@ -198,26 +323,131 @@ func (backend *JWTAuthenticationBackendKeys) GenerateToken(requestClaims map[str
 	return
 }
 
-// Destroy invalidates the token by saving it in our cache, until it expires
-func (backend *JWTAuthenticationBackendKeys) Destroy(token *jwt.Token) error {
+// Destroy invalidates the token by saving it in our cache, until it expires.
+// A revocation event is published for the instances and listeners.
+func (backend *JWTAuthenticationBackendKeys) Destroy(ctx context.Context, token *jwt.Token, client string) error {
+	ctx, cancel := cacheContext(ctx)
+	defer cancel()
+
 	claims := token.Claims.(jwt.MapClaims)
-	return tokenCache.SetValue(token.Raw, token.Raw, backend.GetTokenRemainingValidity(claims["exp"]))
+	ttl := time.Duration(backend.GetTokenRemainingValidity(claims["exp"])) * time.Second
+
+	id := revocationID(token.Raw)
+	localBlacklist.Set(ctx, id, id, ttl)
+	if err := tokenCache.Set(ctx, token.Raw, token.Raw, ttl); err != nil {
+		return err
+	}
+
+	// share the revocation with the other instances
+	if sharedCache, ok := tokenCache.(cache.SharedConnector); ok {
+		if revocations != nil {
+			revocations.add(id)
+		}
+
+		if err := sharedCache.AddMember(ctx, revocationsSet, id, time.Now().Add(ttl)); err != nil {
+			return err
+		}
+
+		event := api.RevocationEvent{ID: id, Client: client}
+		event.JTI, _ = claims["jti"].(string)
+		event.Subject, _ = claims["sub"].(string)
+		if exp, ok := claims["exp"].(float64); ok {
+			event.ExpiresAt = int64(exp)
+		}
+
+		message, _ := json.Marshal(event)
+		return sharedCache.Publish(ctx, revocationsChannel, string(message))
+	}
+
+	return nil
 }
 
 // IsInBlacklist checks if the token has been marked as invalid
-func (backend *JWTAuthenticationBackendKeys) IsInBlacklist(token string) bool {
-	if redisToken, _ := tokenCache.GetValue(token); redisToken == nil {
-		return false
+func (backend *JWTAuthenticationBackendKeys) IsInBlacklist(ctx context.Context, token string) (bool, error) {
+	var id string
+	if revocations != nil {
+		id = revocationID(token)
+		if revoked, final := revocations.lookup(id); final {
+			return revoked, nil
+		}
+	}
+
+	ctx, cancel := cacheContext(ctx)
+	defer cancel()
+
+	exists, err := tokenCache.Exists(ctx, token)
+	if exists && revocations != nil {
+		revocations.hit(id)
+	}
+
+	return exists, err
+}
+
+// IsInLocalBlacklist checks if the token has been invalidated by this instance,
+// or by any other instance when the cache is shared.
+// It is meant to be used as a fallback when the cache cannot be reached.
+func (backend *JWTAuthenticationBackendKeys) IsInLocalBlacklist(token string) bool {
+	exists, _ := localBlacklist.Exists(context.Background(), revocationID(token))
+	return exists
+}
+
+// initRevocationFilter starts the in-process front for blacklist lookups, when
+// enabled, or when a client falls back to the local blacklist, so it mirrors
+// the revocations made by every instance
+func initRevocationFilter(cacheConnector cache.Connector) (err error) {
+	conf := settings.Get().Blacklist.Filter
+	sharedCache, ok := cacheConnector.(cache.SharedConnector)
+
+	if conf.Enabled && !ok {
+		return fmt.Errorf("Blacklist filter requires a shared cache")
+	}
+
+	if !ok || !conf.Enabled && !usesLocalBlacklist() {
+		return
+	}
+
+	filter, err := newRevocationFilter(sharedCache, localBlacklist, conf.Enabled, conf.Capacity, conf.FalsePositiveRate, conf.LRUSize,
+		time.Duration(conf.ResyncInterval)*time.Second)
+	if err != nil {
+		return
+	}
+
+	filter.start()
+	revocations = filter
+	return
+}
+
+// usesLocalBlacklist returns true if any client falls back to the local blacklist
+func usesLocalBlacklist() bool {
+	for _, client := range settings.Get().Clients {
+		if client != nil && client.BlacklistFailure == settings.BlacklistFailLocal {
+			return true
+		}
 	}
+	return false
+}
 
-	return true
+// cacheContext bounds a cache operation with the configured deadline
+func cacheContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultOperationTimeout
+	if operation := settings.Get().Redis.Timeouts.Operation; operation > 0 {
+		timeout = time.Duration(operation) * time.Millisecond
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 // CloseCacheConnections closes all the current connections with the current cache system
-func CloseCacheConnections() {
+func CloseCacheConnections() error {
+	if revocations != nil {
+		revocations.stop()
+	}
+
+	hub.stop()
+
 	if tokenCache != nil {
-		tokenCache.Close()
+		return tokenCache.Close()
 	}
+	return nil
 }
 
 // GetTokenRemainingValidity returns the remaining time for the token expiration,
@@ -268,6 +498,7 @@ func loadKeyStores() (store map[string]*KeyStore, err error) {
 						err = fmt.Errorf("Cannot load private key from %s/%s: %s", dirPath, filesDir[k].Name(), errPK)
 						return
 					}
+					ks.ModTime = filesDir[k].ModTime()
 
 				case "key.pub":
 					// load public key
@@ -276,6 +507,22 @@ func loadKeyStores() (store map[string]*KeyStore, err error) {
 						return
 					}
 
+				case "enc.key":
+					// load token encryption key
+					if errEK := ks.LoadEncryptionKey(path.Join(dirPath, filesDir[k].Name())); errEK != nil {
+						err = fmt.Errorf("Cannot load encryption key from %s/%s: %s", dirPath, filesDir[k].Name(), errEK)
+						return
+					}
+
+				case "enc.pub":
+					// load token encryption public key, unless the private key is present
+					if ks.EncryptionKey == nil {
+						if errEK := ks.LoadEncryptionPublicKey(path.Join(dirPath, filesDir[k].Name())); errEK != nil {
+							err = fmt.Errorf("Cannot load encryption public key from %s/%s: %s", dirPath, filesDir[k].Name(), errEK)
+							return
+						}
+					}
+
 				default:
 
 				}
@@ -283,6 +530,11 @@ func loadKeyStores() (store map[string]*KeyStore, err error) {
 			}
 
 			if ks.IsLoaded() {
+				ks.ID = files[i].Name()
+				ks.KeyID = keyID(ks.PublicKey)
+				if err = ks.checkEncryption(); err != nil {
+					return
+				}
 				store[files[i].Name()] = ks
 			}
 
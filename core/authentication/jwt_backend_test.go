@@ -0,0 +1,51 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestCacheContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		timeout  time.Duration
+	}{
+		{"default", "redis:\n  timeouts:\n    dial: 100\n", defaultOperationTimeout},
+		{"configured", "redis:\n  timeouts:\n    operation: 250\n", 250 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, test.settings)
+
+			ctx, cancel := cacheContext(context.Background())
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("cache context without deadline")
+			}
+			if remaining := time.Until(deadline); remaining > test.timeout || remaining < test.timeout-100*time.Millisecond {
+				t.Errorf("deadline in %s, expected %s", remaining, test.timeout)
+			}
+		})
+	}
+}
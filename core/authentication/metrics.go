@@ -0,0 +1,76 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keyInfoDesc = prometheus.NewDesc("jwt_service_key_info",
+		"Signing key of the client, always 1.", []string{"client", "kid", "algorithm", "bits", "encryption"}, nil)
+	keyAgeDesc = prometheus.NewDesc("jwt_service_key_age_seconds",
+		"Time since the signing key file of the client was modified.", []string{"client"}, nil)
+)
+
+// keyStoreCollector exposes the keys loaded in the backend
+type keyStoreCollector struct {
+	backend *JWTAuthenticationBackendKeys
+}
+
+// Describe implements prometheus.Collector
+func (c keyStoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keyInfoDesc
+	ch <- keyAgeDesc
+}
+
+// Collect implements prometheus.Collector
+func (c keyStoreCollector) Collect(ch chan<- prometheus.Metric) {
+	for client, ks := range c.backend.Store {
+		encryption := strconv.FormatBool(settings.GetClient(client).EncryptTokens && ks.EncryptionKey != nil)
+		ch <- prometheus.MustNewConstMetric(keyInfoDesc, prometheus.GaugeValue, 1,
+			client, ks.KeyID, SigningAlgorithm.Alg(), strconv.Itoa(ks.PublicKey.N.BitLen()), encryption)
+
+		if !ks.ModTime.IsZero() {
+			ch <- prometheus.MustNewConstMetric(keyAgeDesc, prometheus.GaugeValue, time.Since(ks.ModTime).Seconds(), client)
+		}
+	}
+}
+
+// IsKnownClient returns true if the client has keys or settings, so it can
+// be used as a metric label
+func IsKnownClient(id string) bool {
+	if backend := authBackendInstance; backend != nil {
+		if _, exists := backend.GetStore(id); exists {
+			return true
+		}
+	}
+
+	_, exists := settings.Get().Clients[id]
+	return exists
+}
+
+// ClientLabel returns the label of the client in the metrics
+func ClientLabel(id string) string {
+	if IsKnownClient(id) {
+		return id
+	}
+	return metrics.ClientUnknown
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labels returns the labels of the metric by name
+func labels(metric *dto.Metric) map[string]string {
+	values := make(map[string]string)
+	for _, label := range metric.GetLabel() {
+		values[label.GetName()] = label.GetValue()
+	}
+	return values
+}
+
+func TestKeyStoreCollector(t *testing.T) {
+	settings.LoadForTest(t, "clients:\n  encrypted:\n    encrypt_tokens: yes\n  encryption_key:\n    encrypt_tokens: no\n")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &JWTAuthenticationBackendKeys{Store: map[string]*KeyStore{
+		"encrypted":      {KeyID: "kid-1", PrivateKey: key, PublicKey: &key.PublicKey, ModTime: time.Now().Add(-time.Hour), EncryptionKey: &key.PublicKey},
+		"encryption_key": {KeyID: "kid-2", PrivateKey: key, PublicKey: &key.PublicKey, EncryptionKey: &key.PublicKey},
+		"plain":          {KeyID: "kid-3", PrivateKey: key, PublicKey: &key.PublicKey},
+	}}
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(keyStoreCollector{backend: backend})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := make(map[string]map[string]string)
+	age := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			values := labels(metric)
+			switch family.GetName() {
+			case "jwt_service_key_info":
+				info[values["client"]] = values
+			case "jwt_service_key_age_seconds":
+				age[values["client"]] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	tests := []struct {
+		client     string
+		kid        string
+		encryption string
+		age        bool
+	}{
+		{"encrypted", "kid-1", "true", true},
+		{"encryption_key", "kid-2", "false", false}, // key not used without encrypt_tokens
+		{"plain", "kid-3", "false", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.client, func(t *testing.T) {
+			values, exists := info[test.client]
+			if !exists {
+				t.Fatal("key not exposed")
+			}
+			if values["kid"] != test.kid || values["algorithm"] != SigningAlgorithm.Alg() || values["bits"] != "2048" || values["encryption"] != test.encryption {
+				t.Errorf("labels %v", values)
+			}
+
+			seconds, exists := age[test.client]
+			if exists != test.age {
+				t.Fatalf("age exposed = %v, expected %v", exists, test.age)
+			}
+			if exists && (seconds < 3600 || seconds > 3660) {
+				t.Errorf("age %.0f seconds, expected an hour", seconds)
+			}
+		})
+	}
+}
+
+func TestClientLabel(t *testing.T) {
+	settings.LoadForTest(t, "clients:\n  configured:\n    encrypt_tokens: no\n")
+
+	previous := authBackendInstance
+	t.Cleanup(func() { authBackendInstance = previous })
+
+	tests := []struct {
+		name     string
+		backend  *JWTAuthenticationBackendKeys
+		client   string
+		expected string
+	}{
+		{"client with keys", &JWTAuthenticationBackendKeys{Store: map[string]*KeyStore{"keys": {}}}, "keys", "keys"},
+		{"client with settings", &JWTAuthenticationBackendKeys{Store: map[string]*KeyStore{"keys": {}}}, "configured", "configured"},
+		{"backend not initialized", nil, "configured", "configured"},
+		{"unknown client", &JWTAuthenticationBackendKeys{Store: map[string]*KeyStore{"keys": {}}}, "random-1234", metrics.ClientUnknown},
+		{"keys not loaded", nil, "keys", metrics.ClientUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authBackendInstance = test.backend
+			if label := ClientLabel(test.client); label != test.expected {
+				t.Errorf("label %q, expected %q", label, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/logger"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Keys shared by all the service instances
+const (
+	revocationsSet     = "jwt-service:revocations"
+	revocationsChannel = "jwt-service:revocations"
+)
+
+// Default filter values used when they are not configured
+const (
+	defaultFilterCapacity       = 100000
+	defaultFilterFalsePositives = 0.001
+	defaultFilterLRUSize        = 10000
+	defaultFilterResync         = time.Minute
+	filterRetryWait             = 5 * time.Second
+)
+
+// revocationID returns the identifier of a token in the shared set and the
+// revocation events, so raw tokens are not broadcast.
+func revocationID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// revocationFilter answers blacklist lookups in-process. The bloom filter holds
+// every revoked token not expired yet, so a negative answer is final, while the
+// LRU keeps the recent positive answers confirmed by the cache.
+// The filter is loaded from the shared set of revocations and updated through
+// the revocations channel. While the subscription is down, every lookup goes
+// to the cache.
+// Every revocation received is also recorded in the local blacklist, so the
+// revocations made by other instances are known while the cache cannot be
+// reached. When the filter is disabled, it only keeps that mirror.
+type revocationFilter struct {
+	cache          cache.SharedConnector
+	local          cache.Connector
+	enabled        bool
+	capacity       uint
+	falsePositives float64
+	resync         time.Duration
+
+	mutex      sync.RWMutex
+	filter     *bloom.BloomFilter
+	pending    []string // ids received while a reload is in progress
+	subscribed bool
+	synced     bool // subscribed and loaded after the subscription
+
+	reloadMutex sync.Mutex
+	hits        *lru.Cache
+	cancel      context.CancelFunc
+}
+
+func newRevocationFilter(sharedCache cache.SharedConnector, local cache.Connector, enabled bool, capacity int, falsePositives float64, lruSize int, resync time.Duration) (*revocationFilter, error) {
+	if capacity <= 0 {
+		capacity = defaultFilterCapacity
+	}
+
+	if falsePositives <= 0 {
+		falsePositives = defaultFilterFalsePositives
+	}
+
+	if lruSize <= 0 {
+		lruSize = defaultFilterLRUSize
+	}
+
+	if resync <= 0 {
+		resync = defaultFilterResync
+	}
+
+	hits, err := lru.New(lruSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revocationFilter{
+		cache:          sharedCache,
+		local:          local,
+		enabled:        enabled,
+		capacity:       uint(capacity),
+		falsePositives: falsePositives,
+		resync:         resync,
+		hits:           hits,
+	}, nil
+}
+
+// start keeps the filter in sync until stop is called
+func (f *revocationFilter) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+
+	go f.subscribe(ctx)
+	go f.resyncPeriodically(ctx)
+}
+
+func (f *revocationFilter) stop() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// lookup returns if the token id is revoked, and if the answer is final.
+// When it's not final, the cache must be checked.
+func (f *revocationFilter) lookup(id string) (revoked bool, final bool) {
+	if f.hits.Contains(id) {
+		return true, true
+	}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.synced && f.filter != nil && !f.filter.TestString(id) {
+		return false, true
+	}
+
+	return false, false
+}
+
+// hit records a revocation confirmed by the cache
+func (f *revocationFilter) hit(id string) {
+	f.hits.Add(id, nil)
+}
+
+// add records a new revocation
+func (f *revocationFilter) add(id string) {
+	if !f.enabled {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.filter != nil {
+		f.filter.AddString(id)
+	}
+
+	if f.pending != nil {
+		f.pending = append(f.pending, id)
+	}
+}
+
+// mirror records a revocation in the local blacklist until it expires
+func (f *revocationFilter) mirror(ctx context.Context, id string, expiration time.Time) {
+	if f.local == nil {
+		return
+	}
+
+	var ttl time.Duration
+	if !expiration.IsZero() {
+		if ttl = time.Until(expiration); ttl <= 0 {
+			return
+		}
+	}
+
+	f.local.Set(ctx, id, id, ttl)
+}
+
+// reload rebuilds the filter from the shared set, dropping the expired revocations
+func (f *revocationFilter) reload(ctx context.Context) error {
+	f.reloadMutex.Lock()
+	defer f.reloadMutex.Unlock()
+
+	f.mutex.Lock()
+	f.pending = make([]string, 0)
+	f.mutex.Unlock()
+
+	members, err := f.cache.Members(ctx, revocationsSet)
+	if err != nil {
+		f.mutex.Lock()
+		f.pending = nil
+		f.mutex.Unlock()
+		return err
+	}
+
+	for id, expiration := range members {
+		f.mirror(ctx, id, expiration)
+	}
+
+	if !f.enabled {
+		f.mutex.Lock()
+		f.pending = nil
+		f.mutex.Unlock()
+		return nil
+	}
+
+	capacity := f.capacity
+	if n := uint(len(members)) * 2; n > capacity {
+		capacity = n
+	}
+
+	filter := bloom.NewWithEstimates(capacity, f.falsePositives)
+	for id := range members {
+		filter.AddString(id)
+	}
+
+	f.mutex.Lock()
+	for i := range f.pending {
+		filter.AddString(f.pending[i])
+	}
+	f.pending = nil
+	f.filter = filter
+	f.synced = f.subscribed
+	f.mutex.Unlock()
+
+	return nil
+}
+
+func (f *revocationFilter) setSubscribed(subscribed bool) {
+	f.mutex.Lock()
+	f.subscribed = subscribed
+	if !subscribed {
+		f.synced = false
+	}
+	f.mutex.Unlock()
+}
+
+// subscribe listens for revocations published by any instance, subscribing
+// again when the subscription is lost
+func (f *revocationFilter) subscribe(ctx context.Context) {
+	log := logger.GetLogger()
+
+	for {
+		err := f.cache.Subscribe(ctx, revocationsChannel, func() {
+			f.setSubscribed(true)
+			if errReload := f.reload(ctx); errReload != nil {
+				log.Infof("Error loading revoked tokens: %s", errReload)
+			}
+
+		}, func(message string) {
+			var event api.RevocationEvent
+			if errDecode := json.Unmarshal([]byte(message), &event); errDecode != nil {
+				log.Infof("Error decoding revocation event: %s", errDecode)
+				return
+			}
+			f.add(event.ID)
+
+			var expiration time.Time
+			if event.ExpiresAt > 0 {
+				expiration = time.Unix(event.ExpiresAt, 0)
+			}
+			f.mirror(ctx, event.ID, expiration)
+		})
+
+		f.setSubscribed(false)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Infof("Revocations subscription lost, retrying in %s: %s", filterRetryWait, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(filterRetryWait):
+		}
+	}
+}
+
+// resyncPeriodically rebuilds the filter, so it doesn't grow with expired
+// revocations and recovers from any message lost
+func (f *revocationFilter) resyncPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(f.resync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			if err := f.reload(ctx); err != nil {
+				logger.GetLogger().Infof("Error reloading revoked tokens: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/cache/memory"
+)
+
+// sharedCache is a cache.SharedConnector keeping the set of revocations in
+// memory and delivering the given messages once subscribed
+type sharedCache struct {
+	memory.Cache
+	members  map[string]time.Time
+	messages []string
+}
+
+func (c *sharedCache) AddMember(ctx context.Context, set string, member string, expiration time.Time) error {
+	c.members[member] = expiration
+	return nil
+}
+
+func (c *sharedCache) Members(ctx context.Context, set string) (map[string]time.Time, error) {
+	return c.members, nil
+}
+
+func (c *sharedCache) Publish(ctx context.Context, channel string, message string) error {
+	return nil
+}
+
+func (c *sharedCache) Subscribe(ctx context.Context, channel string, subscribed func(), handler func(message string)) error {
+	subscribed()
+	for _, message := range c.messages {
+		handler(message)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func revocationMessage(t *testing.T, id string, expiration time.Time) string {
+	message, err := json.Marshal(api.RevocationEvent{ID: id, ExpiresAt: expiration.Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(message)
+}
+
+func TestRevocationFilter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		members   map[string]time.Time
+		messages  func(t *testing.T) []string
+		revoked   []string
+		notFound  []string
+		finalMiss bool
+	}{
+		{
+			name:    "mirror only",
+			members: map[string]time.Time{"stored": now.Add(time.Hour)},
+			messages: func(t *testing.T) []string {
+				return []string{revocationMessage(t, "published", now.Add(time.Hour))}
+			},
+			revoked:  []string{"stored", "published"},
+			notFound: []string{"unknown"},
+		},
+		{
+			name:    "filter",
+			enabled: true,
+			members: map[string]time.Time{"stored": now.Add(time.Hour)},
+			messages: func(t *testing.T) []string {
+				return []string{revocationMessage(t, "published", now.Add(time.Hour))}
+			},
+			revoked:   []string{"stored", "published"},
+			notFound:  []string{"unknown"},
+			finalMiss: true,
+		},
+		{
+			name:    "expired",
+			members: map[string]time.Time{"stored": now.Add(-time.Minute)},
+			messages: func(t *testing.T) []string {
+				return []string{revocationMessage(t, "published", now.Add(-time.Minute)), "{invalid",
+					revocationMessage(t, "last", now.Add(time.Hour))}
+			},
+			revoked:  []string{"last"},
+			notFound: []string{"stored", "published"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shared := &sharedCache{members: test.members, messages: test.messages(t)}
+			local := new(memory.Cache)
+			local.Init()
+
+			filter, err := newRevocationFilter(shared, local, test.enabled, 0, 0, 0, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go filter.subscribe(ctx)
+
+			for _, id := range test.revoked {
+				waitFor(t, func() bool {
+					exists, _ := local.Exists(ctx, id)
+					return exists
+				})
+			}
+
+			for _, id := range test.notFound {
+				if exists, _ := local.Exists(ctx, id); exists {
+					t.Errorf("%s mirrored", id)
+				}
+			}
+
+			if test.finalMiss {
+				waitFor(t, func() bool {
+					_, final := filter.lookup("unknown")
+					return final
+				})
+			} else if _, final := filter.lookup("unknown"); final {
+				t.Error("lookup answered by a disabled filter")
+			}
+		})
+	}
+}
+
+// waitFor polls the condition until it's true or a second elapses
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
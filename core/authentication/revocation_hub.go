@@ -0,0 +1,162 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/logger"
+)
+
+const (
+	listenerBuffer = 64
+)
+
+// revocationHub delivers the revocations published by any service instance
+// to the local listeners. The subscription starts with the first listener.
+type revocationHub struct {
+	mutex     sync.Mutex
+	listeners map[*revocationListener]struct{}
+	cancel    context.CancelFunc
+}
+
+type revocationListener struct {
+	client string
+	events chan api.RevocationEvent
+}
+
+var hub = &revocationHub{listeners: make(map[*revocationListener]struct{})}
+
+// ListenRevocations returns a channel receiving the revocations of the client's
+// tokens, published by any service instance. The channel is closed when the
+// listener cannot keep up with the events; stop must be called when done.
+func (backend *JWTAuthenticationBackendKeys) ListenRevocations(client string) (events <-chan api.RevocationEvent, stop func(), err error) {
+	sharedCache, ok := tokenCache.(cache.SharedConnector)
+	if !ok {
+		err = fmt.Errorf("Revocations stream requires a shared cache")
+		return
+	}
+
+	listener := &revocationListener{
+		client: client,
+		events: make(chan api.RevocationEvent, listenerBuffer),
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		hub.cancel = cancel
+		go hub.subscribe(ctx, sharedCache)
+	}
+
+	hub.listeners[listener] = struct{}{}
+
+	stop = func() {
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+
+		if _, exists := hub.listeners[listener]; exists {
+			delete(hub.listeners, listener)
+			close(listener.events)
+		}
+	}
+
+	return listener.events, stop, nil
+}
+
+// broadcast sends the event to the listeners of its client. Listeners with a
+// full buffer are dropped, so a slow consumer doesn't block the others.
+func (h *revocationHub) broadcast(event api.RevocationEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for listener := range h.listeners {
+		if listener.client != event.Client {
+			continue
+		}
+
+		select {
+		case listener.events <- event:
+		default:
+			delete(h.listeners, listener)
+			close(listener.events)
+		}
+	}
+}
+
+// subscribe listens for revocations published by any instance, subscribing
+// again when the subscription is lost. The revocations published while the
+// subscription is down are not delivered, so the gaps are logged.
+func (h *revocationHub) subscribe(ctx context.Context, sharedCache cache.SharedConnector) {
+	log := logger.GetLogger()
+	var lostAt time.Time
+
+	for {
+		err := sharedCache.Subscribe(ctx, revocationsChannel, func() {
+			if !lostAt.IsZero() {
+				log.Infof("Revocations subscription restored, events published in the last %s were not streamed", time.Since(lostAt))
+				lostAt = time.Time{}
+			}
+
+		}, func(message string) {
+			var event api.RevocationEvent
+			if errDecode := json.Unmarshal([]byte(message), &event); errDecode != nil {
+				log.Infof("Error decoding revocation event: %s", errDecode)
+				return
+			}
+			h.broadcast(event)
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if lostAt.IsZero() {
+			lostAt = time.Now()
+		}
+
+		log.Infof("Revocations subscription lost, events are not streamed until it's restored, retrying in %s: %s", filterRetryWait, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(filterRetryWait):
+		}
+	}
+}
+
+// stop ends the subscription and disconnects all the listeners
+func (h *revocationHub) stop() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+
+	for listener := range h.listeners {
+		delete(h.listeners, listener)
+		close(listener.events)
+	}
+}
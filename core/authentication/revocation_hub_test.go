@@ -0,0 +1,70 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authentication
+
+import (
+	"testing"
+
+	"github.com/fcoders/jwt-service/api"
+)
+
+func TestRevocationHubBroadcast(t *testing.T) {
+	events := []api.RevocationEvent{
+		{ID: "1", Client: "orders"},
+		{ID: "2", Client: "billing"},
+		{ID: "3", Client: "orders"},
+		{ID: "4", Client: ""},
+	}
+
+	tests := []struct {
+		client   string
+		expected []string
+	}{
+		{"orders", []string{"1", "3"}},
+		{"billing", []string{"2"}},
+		{"shipping", nil},
+	}
+
+	h := &revocationHub{listeners: make(map[*revocationListener]struct{})}
+	listeners := make(map[string]*revocationListener)
+	for _, test := range tests {
+		listener := &revocationListener{client: test.client, events: make(chan api.RevocationEvent, listenerBuffer)}
+		h.listeners[listener] = struct{}{}
+		listeners[test.client] = listener
+	}
+
+	for _, event := range events {
+		h.broadcast(event)
+	}
+	h.stop()
+
+	for _, test := range tests {
+		t.Run(test.client, func(t *testing.T) {
+			var received []string
+			for event := range listeners[test.client].events {
+				received = append(received, event.ID)
+			}
+
+			if len(received) != len(test.expected) {
+				t.Fatalf("received %v, expected %v", received, test.expected)
+			}
+			for i := range received {
+				if received[i] != test.expected[i] {
+					t.Errorf("received %v, expected %v", received, test.expected)
+				}
+			}
+		})
+	}
+}
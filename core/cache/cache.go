@@ -14,11 +14,40 @@
 
 package cache
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTimeout is returned by a Connector when the operation does not complete
+// before the context deadline or the connection timeouts
+var ErrTimeout = errors.New("cache operation timed out")
+
 // Connector is the interface used to hande the cache system configured.
 // Using this interface, you can create connections with Redis, Memcache, and so on.
+// Operations must return when the context is done, reporting ErrTimeout if its
+// deadline was exceeded.
 type Connector interface {
-	Init(params ...string)
-	GetValue(key string) (interface{}, error)
-	SetValue(key string, value string, params ...interface{}) error
-	Close()
+	Init() error
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	SetIfNotExists(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// SharedConnector is implemented by connectors whose storage is shared by all
+// the service instances. Through a set of members with expiration and a
+// notification channel, instances can keep local copies of a set of keys.
+type SharedConnector interface {
+	Connector
+	AddMember(ctx context.Context, set string, member string, expiration time.Time) error
+	Members(ctx context.Context, set string) (map[string]time.Time, error)
+	Publish(ctx context.Context, channel string, message string) error
+
+	// Subscribe calls handler for every message published on the channel. It
+	// calls subscribed once the subscription is active, and blocks until the
+	// context is done or the subscription is lost.
+	Subscribe(ctx context.Context, channel string, subscribed func(), handler func(message string)) error
 }
@@ -0,0 +1,127 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = time.Minute
+)
+
+// Cache is an in-process cache.Connector. Entries are kept until their
+// expiration, so it can be used as a local mirror of the Redis blacklist.
+type Cache struct {
+	mutex     sync.RWMutex
+	entries   map[string]entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	value   string
+	expires time.Time // zero value means no expiration
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// Init initializes the in-memory storage
+func (c *Cache) Init() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]entry)
+	c.lastSweep = time.Now()
+	return nil
+}
+
+// Set creates/replace a key/value pair. When ttl is greater than zero the key
+// expires after it.
+func (c *Cache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.store(key, value, ttl)
+	return nil
+}
+
+// SetIfNotExists creates the key/value pair only if the key is not present,
+// returning true when it was created.
+func (c *Cache) SetIfNotExists(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, exists := c.entries[key]; exists && !e.expired(time.Now()) {
+		return false, nil
+	}
+
+	c.store(key, value, ttl)
+	return true, nil
+}
+
+// store saves the entry, the caller must hold the lock
+func (c *Cache) store(key string, value string, ttl time.Duration) {
+	now := time.Now()
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string]entry)
+	}
+	c.entries[key] = e
+
+	// expired entries are removed periodically, so the map doesn't grow forever
+	if now.Sub(c.lastSweep) > sweepInterval {
+		for k, v := range c.entries {
+			if v.expired(now) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+}
+
+// Exists returns true if the key is present and not expired
+func (c *Cache) Exists(ctx context.Context, key string) (bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, exists := c.entries[key]
+	return exists && !e.expired(time.Now()), nil
+}
+
+// Delete removes the key from the cache
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, key)
+	return nil
+}
+
+// Close releases all the entries
+func (c *Cache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = nil
+	return nil
+}
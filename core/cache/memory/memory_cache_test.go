@@ -0,0 +1,102 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		wait   time.Duration
+		exists bool
+	}{
+		{"without expiration", 0, 30 * time.Millisecond, true},
+		{"not expired", time.Minute, 30 * time.Millisecond, true},
+		{"expired", 10 * time.Millisecond, 30 * time.Millisecond, false},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := new(Cache)
+			c.Init()
+
+			if err := c.Set(ctx, "token", "token", test.ttl); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(test.wait)
+
+			if exists, _ := c.Exists(ctx, "token"); exists != test.exists {
+				t.Errorf("exists = %v, expected %v", exists, test.exists)
+			}
+		})
+	}
+}
+
+func TestSetIfNotExists(t *testing.T) {
+	ctx := context.Background()
+	c := new(Cache)
+	c.Init()
+
+	steps := []struct {
+		name    string
+		action  func() (bool, error)
+		created bool
+	}{
+		{"new key", func() (bool, error) { return c.SetIfNotExists(ctx, "jti", "1", 10*time.Millisecond) }, true},
+		{"existing key", func() (bool, error) { return c.SetIfNotExists(ctx, "jti", "2", time.Minute) }, false},
+		{"expired key", func() (bool, error) {
+			time.Sleep(20 * time.Millisecond)
+			return c.SetIfNotExists(ctx, "jti", "3", 0)
+		}, true},
+		{"key without expiration", func() (bool, error) { return c.SetIfNotExists(ctx, "jti", "4", 0) }, false},
+		{"deleted key", func() (bool, error) {
+			c.Delete(ctx, "jti")
+			return c.SetIfNotExists(ctx, "jti", "5", 0)
+		}, true},
+	}
+
+	for _, step := range steps {
+		if created, err := step.action(); err != nil || created != step.created {
+			t.Errorf("%s: created = %v, %v, expected %v", step.name, created, err, step.created)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	c := new(Cache)
+	c.Init()
+
+	c.Set(ctx, "expired", "expired", time.Millisecond)
+	c.Set(ctx, "kept", "kept", time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	// the next write sweeps the expired entries
+	c.lastSweep = time.Now().Add(-2 * sweepInterval)
+	c.Set(ctx, "new", "new", 0)
+
+	if _, exists := c.entries["expired"]; exists {
+		t.Error("expired entry not removed")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("%d entries, expected 2", len(c.entries))
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+var errClusterUnsupported = errors.New("Redis cluster connections only support Do")
+
+var _ redis.ConnWithContext = (*clusterConn)(nil)
+
+// clusterConn runs commands on a Redis cluster, following its redirections.
+// Cluster connections cannot be cancelled, so the time left before the
+// deadline of the context is used as the read timeout of each attempt.
+type clusterConn struct {
+	cluster     *redisc.Cluster
+	readTimeout time.Duration // when the context has no deadline
+}
+
+// DoContext implements redis.ConnWithContext
+func (c *clusterConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (reply interface{}, err error) {
+	for attempt := 0; attempt < clusterRetries; attempt++ {
+		timeout := c.readTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return nil, context.DeadlineExceeded
+			}
+		}
+
+		conn, ok := c.cluster.Get().(*redisc.Conn)
+		if !ok {
+			return nil, errors.New("Unexpected Redis cluster connection")
+		}
+		reply, err = conn.DoWithTimeout(timeout, cmd, args...)
+		conn.Close()
+
+		redirection := redisc.ParseRedir(err)
+		switch {
+		case redirection != nil && redirection.Type == "ASK":
+			// the slot is being migrated, only a connection following the
+			// redirection can ask the node importing it
+			return c.doRedirected(cmd, args...)
+		case redirection != nil:
+			// MOVED, the failed attempt updated the slot mapping
+		case redisc.IsTryAgain(err):
+			time.Sleep(clusterRetryWait)
+		default:
+			return reply, err
+		}
+	}
+
+	return nil, errors.New("Too many redirections from the Redis cluster")
+}
+
+// doRedirected runs the command on a connection following the ASK
+// redirections, bounded by the read timeout of the connections
+func (c *clusterConn) doRedirected(cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := redisc.RetryConn(c.cluster.Get(), clusterRetries, clusterRetryWait)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.Do(cmd, args...)
+}
+
+// Do implements redis.Conn
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoContext(context.Background(), cmd, args...)
+}
+
+// ReceiveContext implements redis.ConnWithContext
+func (c *clusterConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return nil, errClusterUnsupported
+}
+
+// Close implements redis.Conn, every command releases its connection
+func (c *clusterConn) Close() error { return nil }
+
+// Err implements redis.Conn
+func (c *clusterConn) Err() error { return nil }
+
+// Send implements redis.Conn
+func (c *clusterConn) Send(cmd string, args ...interface{}) error { return errClusterUnsupported }
+
+// Flush implements redis.Conn
+func (c *clusterConn) Flush() error { return errClusterUnsupported }
+
+// Receive implements redis.Conn
+func (c *clusterConn) Receive() (interface{}, error) { return nil, errClusterUnsupported }
@@ -0,0 +1,144 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Default values used when they are not configured
+const (
+	defaultMaxIdle      = 3
+	defaultIdleTimeout  = 240 * time.Second
+	defaultReadTimeout  = 3 * time.Second
+	defaultWriteTimeout = 3 * time.Second
+)
+
+// Config holds the options used to connect to Redis
+type Config struct {
+	Mode     string
+	Address  string
+	Username string // Redis 6 ACL user, empty for the default user
+	Password string
+	Database int
+
+	MasterName        string
+	SentinelAddresses []string
+	ClusterAddresses  []string
+
+	TLS TLSConfig
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	MaxIdle     int
+	MaxActive   int // zero means no limit
+	IdleTimeout time.Duration
+	Wait        bool // wait for a free connection when MaxActive is reached
+}
+
+// TLSConfig holds the options used to establish TLS connections with Redis
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// load builds a tls.Config from the files configured
+func (c TLSConfig) load() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		caCert, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading Redis CA file: %s", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("No certificates found in Redis CA file %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading Redis client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// readTimeout returns the configured read timeout, never unbounded
+func (c Config) readTimeout() time.Duration {
+	if c.ReadTimeout > 0 {
+		return c.ReadTimeout
+	}
+	return defaultReadTimeout
+}
+
+// writeTimeout returns the configured write timeout, never unbounded
+func (c Config) writeTimeout() time.Duration {
+	if c.WriteTimeout > 0 {
+		return c.WriteTimeout
+	}
+	return defaultWriteTimeout
+}
+
+// dialOptions returns the options used for every connection to a Redis node
+func (c Config) dialOptions() (options []redis.DialOption, err error) {
+	options = []redis.DialOption{
+		redis.DialConnectTimeout(c.DialTimeout),
+		redis.DialReadTimeout(c.readTimeout()),
+		redis.DialWriteTimeout(c.writeTimeout()),
+		redis.DialUsername(c.Username),
+		redis.DialPassword(c.Password),
+	}
+
+	if c.Database != 0 {
+		if c.Mode == ModeCluster {
+			err = errors.New("Redis cluster does not support database selection")
+			return
+		}
+		options = append(options, redis.DialDatabase(c.Database))
+	}
+
+	if c.TLS.Enabled {
+		tlsConfig, errTLS := c.TLS.load()
+		if errTLS != nil {
+			err = errTLS
+			return
+		}
+		options = append(options, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+	}
+
+	return
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDialOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		commands [][]string // sent when connecting
+		invalid  bool
+	}{
+		{name: "default", config: Config{}},
+		{name: "password", config: Config{Password: "secret"}, commands: [][]string{{"AUTH", "secret"}}},
+		{name: "acl user", config: Config{Username: "jwt", Password: "secret"}, commands: [][]string{{"AUTH", "jwt", "secret"}}},
+		{name: "database", config: Config{Database: 2}, commands: [][]string{{"SELECT", "2"}}},
+		{name: "cluster database", config: Config{Mode: ModeCluster, Database: 2}, invalid: true},
+		{name: "missing CA file", config: Config{TLS: TLSConfig{Enabled: true, CAFile: "missing.pem"}}, invalid: true},
+		{name: "missing certificate", config: Config{TLS: TLSConfig{Enabled: true, CertFile: "missing.pem", KeyFile: "missing.key"}}, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.config.dialOptions()
+			if invalid := err != nil; invalid != test.invalid {
+				t.Fatalf("invalid = %v, expected %v: %v", invalid, test.invalid, err)
+			}
+			if test.invalid {
+				return
+			}
+
+			server := newFakeServer(t)
+			pool := &Pool{Config: test.config}
+			pool.Config.Address = server.addr
+			if err := pool.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+
+			if _, err := pool.Exists(context.Background(), "token"); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := append(test.commands, []string{"EXISTS", "token"})
+			if commands := server.received(); !reflect.DeepEqual(commands, expected) {
+				t.Errorf("commands %v, expected %v", commands, expected)
+			}
+		})
+	}
+}
+
+func TestDefaultTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		read   time.Duration
+		write  time.Duration
+	}{
+		{"not configured", Config{}, defaultReadTimeout, defaultWriteTimeout},
+		{"configured", Config{ReadTimeout: time.Second, WriteTimeout: 2 * time.Second}, time.Second, 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if read, write := test.config.readTimeout(), test.config.writeTimeout(); read != test.read || write != test.write {
+				t.Errorf("timeouts %s/%s, expected %s/%s", read, write, test.read, test.write)
+			}
+		})
+	}
+}
@@ -15,81 +15,404 @@
 package redis
 
 import (
+	"context"
 	"errors"
+	"net"
 	"time"
 
-	"github.com/garyburd/redigo/redis"
+	"github.com/FZambia/sentinel"
+	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mna/redisc"
+)
+
+// Connection modes supported by Pool
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+const (
+	sentinelTimeout  = 500 * time.Millisecond
+	clusterRetries   = 3
+	clusterRetryWait = 100 * time.Millisecond
+	subscriptionPing = 15 * time.Second
 )
 
 // Pool holds a connection pool to a Redis server.
+// When the mode is ModeSentinel, the master address is discovered through the
+// configured sentinels. When the mode is ModeCluster, commands are routed to
+// the node owning the key slot.
 type Pool struct {
 	Connection *redis.Pool
+	Config     Config
+
+	sentinel *sentinel.Sentinel
+	cluster  *redisc.Cluster
 }
 
-// Init creates a connection pool to Redis.
-func (p *Pool) Init(params ...string) {
-	p.Connection = &redis.Pool{
-		MaxIdle:     3,
-		IdleTimeout: 240 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", params[0])
+// Init creates a connection pool to Redis, using the options in Config.
+// In sentinel and cluster mode the address is ignored and the configured
+// node lists are used instead.
+func (p *Pool) Init() error {
+	options, err := p.Config.dialOptions()
+	if err != nil {
+		return err
+	}
+
+	switch p.Config.Mode {
+
+	case ModeSentinel:
+		p.sentinel = &sentinel.Sentinel{
+			Addrs:      p.Config.SentinelAddresses,
+			MasterName: p.Config.MasterName,
+			Dial: func(addr string) (redis.Conn, error) {
+				return redis.Dial("tcp", addr,
+					redis.DialConnectTimeout(sentinelTimeout),
+					redis.DialReadTimeout(sentinelTimeout),
+					redis.DialWriteTimeout(sentinelTimeout))
+			},
+		}
+
+		p.Connection = p.newPool(func() (redis.Conn, error) {
+			masterAddr, err := p.sentinel.MasterAddr()
 			if err != nil {
 				return nil, err
 			}
+			return redis.Dial("tcp", masterAddr, options...)
+		})
+
+		// after a failover, idle connections to the old master are discarded
+		p.Connection.TestOnBorrowContext = func(ctx context.Context, c redis.Conn, t time.Time) error {
+			return testRole(ctx, c, "master")
+		}
+
+	case ModeCluster:
+		p.cluster = &redisc.Cluster{
+			StartupNodes: p.Config.ClusterAddresses,
+			DialOptions:  options,
+			CreatePool: func(addr string, opts ...redis.DialOption) (*redis.Pool, error) {
+				return p.newPool(func() (redis.Conn, error) {
+					return redis.Dial("tcp", addr, opts...)
+				}), nil
+			},
+		}
+
+		// if the slots mapping cannot be loaded now, it is refreshed
+		// on the first redirection received from the cluster
+		p.cluster.Refresh()
+
+	default:
+		p.Connection = p.newPool(func() (redis.Conn, error) {
+			return redis.Dial("tcp", p.Config.Address, options...)
+		})
+	}
+
+	return nil
+}
+
+// Set creates/replace a key/value pair on Redis. When ttl is greater than
+// zero the key expires after it, set atomically with the value.
+func (p *Pool) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := []interface{}{key, value}
+	if ttl > 0 {
+		args = append(args, "EX", expirationSeconds(ttl))
+	}
+
+	_, err = do(ctx, conn, "SET", args...)
+	return err
+}
+
+// SetIfNotExists creates the key/value pair only if the key is not present,
+// returning true when it was created.
+func (p *Pool) SetIfNotExists(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	args := []interface{}{key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "EX", expirationSeconds(ttl))
+	}
+
+	reply, err := do(ctx, conn, "SET", args...)
+	return reply != nil, err
+}
+
+// Exists returns true if the key is present on the server.
+func (p *Pool) Exists(ctx context.Context, key string) (bool, error) {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	return redis.Bool(do(ctx, conn, "EXISTS", key))
+}
+
+// Delete removes the key from the server. Deleting a missing key is not an error.
+func (p *Pool) Delete(ctx context.Context, key string) error {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = do(ctx, conn, "DEL", key)
+	return err
+}
+
+// AddMember adds a member to a sorted set, scored by its expiration. Expired
+// members are removed on every call.
+func (p *Pool) AddMember(ctx context.Context, set string, member string, expiration time.Time) error {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = do(ctx, conn, "ZADD", set, expiration.Unix(), member); err != nil {
+		return err
+	}
+
+	_, err = do(ctx, conn, "ZREMRANGEBYSCORE", set, "-inf", time.Now().Unix())
+	return err
+}
+
+// Members returns the not expired members of a sorted set filled with AddMember,
+// with their expiration.
+func (p *Pool) Members(ctx context.Context, set string) (map[string]time.Time, error) {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	scores, err := redis.Int64Map(do(ctx, conn, "ZRANGEBYSCORE", set, time.Now().Unix(), "+inf", "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]time.Time, len(scores))
+	for member, expiration := range scores {
+		members[member] = time.Unix(expiration, 0)
+	}
+	return members, nil
+}
+
+// Publish sends a message to all the subscribers of the channel.
+func (p *Pool) Publish(ctx context.Context, channel string, message string) error {
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = do(ctx, conn, "PUBLISH", channel, message)
+	return err
+}
+
+// Subscribe listens for the messages published on the channel, using a
+// dedicated connection. The connection is pinged periodically, so a broken
+// subscription is detected after two ping intervals at most.
+func (p *Pool) Subscribe(ctx context.Context, channel string, subscribed func(), handler func(message string)) error {
+	conn, err := p.dial()
+	if err != nil {
+		return err
+	}
 
-			// if we have a password, do AUTH
-			if params[1] != "" {
-				if _, err := c.Do("AUTH", params[1]); err != nil {
-					c.Close()
-					return nil, err
-				}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err = psc.Subscribe(channel); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(subscriptionPing)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// unblocks the receive loop
+				psc.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				psc.Ping("")
 			}
+		}
+	}()
 
-			return c, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * subscriptionPing).(type) {
+		case redis.Message:
+			handler(string(v.Data))
+		case redis.Subscription:
+			if v.Kind == "subscribe" && subscribed != nil {
+				subscribed()
 			}
-			_, err := c.Do("PING")
-			return err
-		},
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return v
+		}
 	}
 }
 
-// SetValue creates/replace a key/value pair on Redis.
-func (p *Pool) SetValue(key string, value string, expiration ...interface{}) error {
+// Close ends all the connecctions with Redis server
+func (p *Pool) Close() (err error) {
 	if p.Connection != nil {
+		err = p.Connection.Close()
+	}
 
-		conn := p.Connection.Get()
-		defer conn.Close()
-
-		_, err := conn.Do("SET", key, value)
-
-		if err == nil && expiration != nil {
-			p.Connection.Get().Do("EXPIRE", key, expiration[0])
+	if p.sentinel != nil {
+		if errSentinel := p.sentinel.Close(); err == nil {
+			err = errSentinel
 		}
+	}
 
-		return err
+	if p.cluster != nil {
+		if errCluster := p.cluster.Close(); err == nil {
+			err = errCluster
+		}
 	}
 
-	return errors.New("Redis cache not initialized")
+	return
 }
 
-// GetValue retrieves an existing key/value pair from the server.
-func (p *Pool) GetValue(key string) (interface{}, error) {
+// get returns a connection for the configured mode. In cluster mode the
+// connection follows MOVED/ASK redirections, so slot migrations and failovers
+// are handled transparently.
+func (p *Pool) get(ctx context.Context) (redis.Conn, error) {
+	if p.cluster != nil {
+		return &clusterConn{cluster: p.cluster, readTimeout: p.Config.readTimeout()}, nil
+	}
+
 	if p.Connection != nil {
-		conn := p.Connection.Get()
-		defer conn.Close()
-		return conn.Do("GET", key)
+		conn, err := p.Connection.GetContext(ctx)
+		return conn, timeoutError(ctx, err)
 	}
 
 	return nil, errors.New("Redis cache not initialized")
 }
 
-// Close ends all the connecctions with Redis server
-func (p *Pool) Close() {
+// dial opens a connection outside of the pool, for long lived uses like
+// subscriptions.
+func (p *Pool) dial() (redis.Conn, error) {
+	if p.cluster != nil {
+		return p.cluster.Dial()
+	}
+
 	if p.Connection != nil {
-		p.Connection.Close()
+		return p.Connection.Dial()
+	}
+
+	return nil, errors.New("Redis cache not initialized")
+}
+
+// do executes the command bound to the context
+func do(ctx context.Context, conn redis.Conn, cmd string, args ...interface{}) (reply interface{}, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RedisDuration.WithLabelValues(cmd).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.RedisErrors.WithLabelValues(cmd).Inc()
+		}
+	}()
+
+	if _, ok := conn.(redis.ConnWithContext); ok {
+		reply, err = redis.DoContext(conn, ctx, cmd, args...)
+	} else {
+		reply, err = conn.Do(cmd, args...)
+	}
+
+	return reply, timeoutError(ctx, err)
+}
+
+// timeoutError translates deadline and network timeout errors to cache.ErrTimeout
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return cache.ErrTimeout
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return cache.ErrTimeout
+	}
+
+	return err
+}
+
+func (p *Pool) newPool(dialFunc func() (redis.Conn, error)) *redis.Pool {
+	pool := &redis.Pool{
+		MaxIdle:     p.Config.MaxIdle,
+		MaxActive:   p.Config.MaxActive,
+		IdleTimeout: p.Config.IdleTimeout,
+		Wait:        p.Config.Wait,
+		Dial:        dialFunc,
+		TestOnBorrowContext: func(ctx context.Context, c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := redis.DoContext(c, ctx, "PING")
+			return err
+		},
+	}
+
+	if pool.MaxIdle == 0 {
+		pool.MaxIdle = defaultMaxIdle
+	}
+
+	if pool.IdleTimeout == 0 {
+		pool.IdleTimeout = defaultIdleTimeout
+	}
+
+	return pool
+}
+
+// testRole returns an error if the server does not have the role, checked
+// within the deadline of the context
+func testRole(ctx context.Context, c redis.Conn, expected string) error {
+	reply, err := redis.Values(redis.DoContext(c, ctx, "ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("Redis role check failed")
+	}
+
+	role, err := redis.String(reply[0], nil)
+	if err != nil || role != expected {
+		return errors.New("Redis role check failed")
+	}
+	return nil
+}
+
+// expirationSeconds rounds ttl up to whole seconds, as required by SET EX
+func expirationSeconds(ttl time.Duration) int64 {
+	seconds := int64(ttl / time.Second)
+	if ttl%time.Second != 0 {
+		seconds++
 	}
+	return seconds
 }
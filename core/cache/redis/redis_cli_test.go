@@ -0,0 +1,248 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/core/cache"
+)
+
+// hungServer accepts connections and never answers, like a Redis node that
+// stopped responding
+func hungServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for i := range conns {
+				conns[i].Close()
+			}
+		}()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestHungServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  func(addr string) Config
+		timeout time.Duration // of the context, none when zero
+	}{
+		{"standalone", func(addr string) Config { return Config{Address: addr} }, 100 * time.Millisecond},
+		{"cluster", func(addr string) Config { return Config{Mode: ModeCluster, ClusterAddresses: []string{addr}} }, 100 * time.Millisecond},
+		{"standalone without deadline", func(addr string) Config { return Config{Address: addr, ReadTimeout: 100 * time.Millisecond} }, 0},
+		{"cluster without deadline", func(addr string) Config {
+			return Config{Mode: ModeCluster, ClusterAddresses: []string{addr}, ReadTimeout: 100 * time.Millisecond}
+		}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := &Pool{Config: test.config(hungServer(t))}
+			if err := pool.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+
+			ctx := context.Background()
+			if test.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err := pool.Exists(ctx, "token")
+			if err != cache.ErrTimeout {
+				t.Errorf("got %v, expected %v", err, cache.ErrTimeout)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("blocked for %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestInitModes(t *testing.T) {
+	// nodes refusing connections, so the cluster slots cannot be loaded
+	unreachable := []string{"127.0.0.1:1"}
+
+	tests := []struct {
+		name     string
+		config   Config
+		pool     bool
+		sentinel bool
+		cluster  bool
+	}{
+		{name: "default", config: Config{Address: "127.0.0.1:6379"}, pool: true},
+		{name: "standalone", config: Config{Mode: ModeStandalone, Address: "127.0.0.1:6379"}, pool: true},
+		{name: "sentinel", config: Config{Mode: ModeSentinel, MasterName: "mymaster", SentinelAddresses: unreachable}, pool: true, sentinel: true},
+		{name: "cluster", config: Config{Mode: ModeCluster, ClusterAddresses: unreachable}, cluster: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := &Pool{Config: test.config}
+			if err := pool.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+
+			if (pool.Connection != nil) != test.pool || (pool.sentinel != nil) != test.sentinel || (pool.cluster != nil) != test.cluster {
+				t.Errorf("pool %v, sentinel %v, cluster %v", pool.Connection != nil, pool.sentinel != nil, pool.cluster != nil)
+			}
+		})
+	}
+}
+
+// fakePool returns a standalone pool connected to a fake server
+func fakePool(t *testing.T) (*Pool, *fakeServer) {
+	t.Helper()
+
+	server := newFakeServer(t)
+	pool := &Pool{Config: Config{Address: server.addr}}
+	if err := pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	return pool, server
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		expected []string
+	}{
+		{"without expiration", 0, []string{"SET", "token", "value"}},
+		{"expiration", time.Minute, []string{"SET", "token", "value", "EX", "60"}},
+		{"rounded up", 1500 * time.Millisecond, []string{"SET", "token", "value", "EX", "2"}},
+		{"under a second", time.Millisecond, []string{"SET", "token", "value", "EX", "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, server := fakePool(t)
+
+			if err := pool.Set(context.Background(), "token", "value", test.ttl); err != nil {
+				t.Fatal(err)
+			}
+
+			// the expiration is set along with the value, in one command
+			if commands := server.received(); !reflect.DeepEqual(commands, [][]string{test.expected}) {
+				t.Errorf("commands %v, expected %v", commands, [][]string{test.expected})
+			}
+		})
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	pool, _ := fakePool(t)
+	ctx := context.Background()
+
+	if err := pool.Set(ctx, "token", "value", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := pool.Exists(ctx, "token"); err != nil || !exists {
+		t.Fatalf("exists = %v, %v before expiring", exists, err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if exists, err := pool.Exists(ctx, "token"); err != nil || exists {
+		t.Errorf("exists = %v, %v after expiring", exists, err)
+	}
+}
+
+func TestSetIfNotExists(t *testing.T) {
+	pool, server := fakePool(t)
+	ctx := context.Background()
+
+	steps := []struct {
+		name    string
+		action  func() (bool, error)
+		created bool
+	}{
+		{"new key", func() (bool, error) { return pool.SetIfNotExists(ctx, "jti", "1", time.Minute) }, true},
+		{"existing key", func() (bool, error) { return pool.SetIfNotExists(ctx, "jti", "2", time.Minute) }, false},
+		{"after delete", func() (bool, error) { return true, pool.Delete(ctx, "jti") }, true},
+		{"deleted key", func() (bool, error) { return pool.SetIfNotExists(ctx, "jti", "3", 0) }, true},
+	}
+
+	for _, step := range steps {
+		created, err := step.action()
+		if err != nil || created != step.created {
+			t.Errorf("%s: created = %v, %v, expected %v", step.name, created, err, step.created)
+		}
+	}
+
+	expected := [][]string{
+		{"SET", "jti", "1", "NX", "EX", "60"},
+		{"SET", "jti", "2", "NX", "EX", "60"},
+		{"DEL", "jti"},
+		{"SET", "jti", "3", "NX"},
+	}
+	if commands := server.received(); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("commands %v, expected %v", commands, expected)
+	}
+}
+
+func TestSentinelRoleCheck(t *testing.T) {
+	tests := []struct {
+		role  string
+		valid bool
+	}{
+		{"master", true},
+		{"slave", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role, func(t *testing.T) {
+			pool, server := fakePool(t)
+			server.role = test.role
+
+			conn, err := pool.Connection.Dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := testRole(context.Background(), conn, "master"); (err == nil) != test.valid {
+				t.Errorf("role %s accepted = %v", test.role, err == nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks enough of the Redis protocol to test the commands sent by
+// the connector. Keys honour the EX and NX options of SET.
+type fakeServer struct {
+	addr string
+	role string // reply to ROLE
+
+	sync.Mutex
+	commands [][]string
+	values   map[string]string
+	expiries map[string]time.Time
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeServer{
+		addr:     listener.Addr().String(),
+		role:     "master",
+		values:   make(map[string]string),
+		expiries: make(map[string]time.Time),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// received returns the commands received, without the connection checks
+func (s *fakeServer) received() [][]string {
+	s.Lock()
+	defer s.Unlock()
+
+	var commands [][]string
+	for _, cmd := range s.commands {
+		if cmd[0] != "PING" && cmd[0] != "ROLE" {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		if _, err = io.WriteString(conn, s.execute(cmd)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) execute(cmd []string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	cmd[0] = strings.ToUpper(cmd[0])
+	s.commands = append(s.commands, cmd)
+
+	for key, expiry := range s.expiries {
+		if time.Now().After(expiry) {
+			delete(s.values, key)
+			delete(s.expiries, key)
+		}
+	}
+
+	switch cmd[0] {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	case "ROLE":
+		return fmt.Sprintf("*1\r\n$%d\r\n%s\r\n", len(s.role), s.role)
+	case "SET":
+		key, value := cmd[1], cmd[2]
+		var expiry time.Time
+		for i := 3; i < len(cmd); i++ {
+			switch strings.ToUpper(cmd[i]) {
+			case "NX":
+				if _, exists := s.values[key]; exists {
+					return "$-1\r\n"
+				}
+			case "EX":
+				i++
+				seconds, _ := strconv.Atoi(cmd[i])
+				expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		}
+		s.values[key] = value
+		delete(s.expiries, key)
+		if !expiry.IsZero() {
+			s.expiries[key] = expiry
+		}
+		return "+OK\r\n"
+	case "EXISTS", "DEL":
+		_, exists := s.values[cmd[1]]
+		if cmd[0] == "DEL" {
+			delete(s.values, cmd[1])
+			delete(s.expiries, cmd[1])
+		}
+		if exists {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := make([]string, n)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(data[:size])
+	}
+	return cmd, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// Headers used by the callers to prove they own the client in Auth-Client
+const (
+	HeaderAPIKey    = "Auth-Key"
+	HeaderSignature = "Auth-Signature" // t=<unix time>,n=<nonce>,v1=<hex HMAC-SHA256>
+)
+
+const (
+	maxSignatureSkew      = 5 * time.Minute
+	maxNonceLength        = 128
+	signatureReplayPrefix = "signature:"
+)
+
+// ErrUnauthorizedCaller is returned when the caller cannot prove it owns the client
+var ErrUnauthorizedCaller = errors.New("Caller not authorized for the client")
+
+// AuthenticateCaller checks the caller owns the client, with a TLS client
+// certificate mapped to it, an API key or a HMAC signature of the request.
+// Clients without caller credentials are only accepted when caller
+// authentication is not required in settings.
+func AuthenticateCaller(r *http.Request, body []byte, clientID string) error {
+	client := settings.GetClient(clientID)
+
+	if cert := VerifiedCertificate(r); cert != nil {
+		if id, found := ClientForCertificate(cert); found && id == clientID {
+			return nil
+		}
+	}
+
+	if !HasCallerCredentials(clientID) {
+		if settings.Get().App.RequireCallerAuth {
+			return ErrUnauthorizedCaller
+		}
+		return nil
+	}
+
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		if verifyAPIKey(key, client.APIKeyHashes) {
+			return nil
+		}
+		return ErrUnauthorizedCaller
+	}
+
+	if signature := r.Header.Get(HeaderSignature); signature != "" {
+		if verifySignature(r.Context(), signature, r, body, clientID, client.HMACSecrets) {
+			return nil
+		}
+	}
+
+	return ErrUnauthorizedCaller
+}
+
+// HasCallerCredentials returns true if the callers of the client can be
+// authenticated with a certificate, an API key or a HMAC signature
+func HasCallerCredentials(clientID string) bool {
+	client := settings.GetClient(clientID)
+	return len(client.APIKeyHashes) > 0 || len(client.HMACSecrets) > 0 || len(client.CertificateSubjects) > 0
+}
+
+// verifyAPIKey compares the SHA-256 of the key with the configured hashes
+func verifyAPIKey(key string, hashes []string) bool {
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+
+	for i := range hashes {
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(strings.ToLower(hashes[i]))) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks a signature created as
+// HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + method + "\n" + request URI + "\n" + client + "\n" + body)
+// Each nonce is accepted once while the timestamp is within the allowed skew.
+func verifySignature(ctx context.Context, header string, r *http.Request, body []byte, clientID string, secrets []string) bool {
+	var timestamp, nonce, signature string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "n":
+			nonce = kv[1]
+		case "v1":
+			signature = kv[1]
+		}
+	}
+
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" || len(nonce) > maxNonceLength {
+		return false
+	}
+
+	skew := time.Since(time.Unix(unixTime, 0))
+	if skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	for i := range secrets {
+		mac := hmac.New(sha256.New, []byte(secrets[i]))
+		mac.Write([]byte(timestamp + "\n" + nonce + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + clientID + "\n"))
+		mac.Write(body)
+
+		if hmac.Equal(mac.Sum(nil), expected) {
+			return firstUse(ctx, signatureReplayPrefix+clientID+":"+nonce, time.Unix(unixTime, 0).Add(maxSignatureSkew))
+		}
+	}
+	return false
+}
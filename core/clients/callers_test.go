@@ -0,0 +1,140 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/google/uuid"
+)
+
+func signRequest(secret string, timestamp time.Time, nonce string, method string, uri string, clientID string, body string) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "\n" + nonce + "\n" + method + "\n" + uri + "\n" + clientID + "\n" + body))
+	return "t=" + t + ",n=" + nonce + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticateCaller(t *testing.T) {
+	keyHash := sha256.Sum256([]byte("api-key"))
+	clientsSettings := fmt.Sprintf(`
+  keyed:
+    api_key_hashes: ["%s"]
+  signed:
+    hmac_secrets: ["old", "current"]
+  open:
+    blacklist_failure: closed
+`, hex.EncodeToString(keyHash[:]))
+
+	body := `{"sub":"user"}`
+	now := time.Now()
+	replayed := signRequest("current", now, "nonce", http.MethodPost, "/v1/token/generate", "signed", body)
+	initReplays(t)
+
+	tests := []struct {
+		name       string
+		settings   string
+		client     string
+		header     http.Header
+		authorized bool
+	}{
+		{name: "api key", client: "keyed", header: http.Header{HeaderAPIKey: {"api-key"}}, authorized: true},
+		{name: "wrong api key", client: "keyed", header: http.Header{HeaderAPIKey: {"other"}}},
+		{name: "api key of another client", client: "signed", header: http.Header{HeaderAPIKey: {"api-key"}}},
+		{name: "no credentials", client: "keyed"},
+		{
+			name:       "signature",
+			client:     "signed",
+			header:     http.Header{HeaderSignature: {signRequest("current", now, uuid.New().String(), http.MethodPost, "/v1/token/generate", "signed", body)}},
+			authorized: true,
+		},
+		{
+			name:       "signature with previous secret",
+			client:     "signed",
+			header:     http.Header{HeaderSignature: {signRequest("old", now, uuid.New().String(), http.MethodPost, "/v1/token/generate", "signed", body)}},
+			authorized: true,
+		},
+		{
+			name:   "stale signature",
+			client: "signed",
+			header: http.Header{HeaderSignature: {signRequest("current", now.Add(-10*time.Minute), uuid.New().String(), http.MethodPost, "/v1/token/generate", "signed", body)}},
+		},
+		{
+			name:       "nonce used",
+			client:     "signed",
+			header:     http.Header{HeaderSignature: {replayed}},
+			authorized: true,
+		},
+		{
+			// runs after the nonce was used
+			name:   "signature replayed",
+			client: "signed",
+			header: http.Header{HeaderSignature: {replayed}},
+		},
+		{
+			name:   "signature without nonce",
+			client: "signed",
+			header: http.Header{HeaderSignature: {signRequest("current", now, "", http.MethodPost, "/v1/token/generate", "signed", body)}},
+		},
+		{
+			name:   "signature with another nonce",
+			client: "signed",
+			header: http.Header{HeaderSignature: {strings.Replace(signRequest("current", now, "nonce-1", http.MethodPost, "/v1/token/generate", "signed", body), "n=nonce-1", "n=nonce-2", 1)}},
+		},
+		{
+			name:   "signature of another request",
+			client: "signed",
+			header: http.Header{HeaderSignature: {signRequest("current", now, uuid.New().String(), http.MethodPost, "/v1/token/destroy", "signed", body)}},
+		},
+		{
+			name:   "signature of another client",
+			client: "signed",
+			header: http.Header{HeaderSignature: {signRequest("current", now, uuid.New().String(), http.MethodPost, "/v1/token/generate", "keyed", body)}},
+		},
+		{name: "client without credentials", client: "open"},
+		{name: "unknown client", client: "unknown"},
+		{name: "required explicitly", settings: "app:\n  require_caller_auth: yes\n", client: "open"},
+		{name: "not required", settings: "app:\n  require_caller_auth: no\n", client: "open", authorized: true},
+		{name: "not required with credentials", settings: "app:\n  require_caller_auth: no\n", client: "keyed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, test.settings+"clients:"+clientsSettings)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/token/generate", strings.NewReader(body))
+			for k, v := range test.header {
+				r.Header[k] = v
+			}
+
+			err := AuthenticateCaller(r, []byte(body), test.client)
+			if test.authorized && err != nil {
+				t.Errorf("caller not authorized: %s", err)
+			} else if !test.authorized && err != ErrUnauthorizedCaller {
+				t.Errorf("got %v, expected %v", err, ErrUnauthorizedCaller)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"crypto/x509"
+	"net/http"
+	"sort"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// VerifiedCertificate returns the client certificate verified during the TLS
+// handshake, or nil if there is none
+func VerifiedCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// ClientForCertificate returns the client whose certificate_subjects match the
+// certificate subject or common name. When several clients match, the first
+// one in the order of their IDs is returned.
+func ClientForCertificate(cert *x509.Certificate) (clientID string, found bool) {
+	subject := cert.Subject.String()
+
+	configured := settings.Get().Clients
+	ids := make([]string, 0, len(configured))
+	for id := range configured {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		client := configured[id]
+		if client == nil {
+			continue
+		}
+
+		for i := range client.CertificateSubjects {
+			if client.CertificateSubjects[i] == subject || client.CertificateSubjects[i] == cert.Subject.CommonName {
+				return id, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestClientForCertificate(t *testing.T) {
+	settings.LoadForTest(t, `
+clients:
+  orders:
+    certificate_subjects: ["CN=orders,O=Example"]
+  billing:
+    certificate_subjects: ["billing", "shared"]
+  audit:
+    certificate_subjects: ["shared"]
+  reports:
+    certificate_subjects: ["CN=shared,O=Example"]
+`)
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		client  string
+	}{
+		{"subject", pkix.Name{CommonName: "orders", Organization: []string{"Example"}}, "orders"},
+		{"common name", pkix.Name{CommonName: "billing"}, "billing"},
+		{"unknown", pkix.Name{CommonName: "orders", Organization: []string{"Other"}}, ""},
+		// the first client in order of ID, whatever the map order
+		{"shared common name", pkix.Name{CommonName: "shared"}, "audit"},
+		{"shared by subject and common name", pkix.Name{CommonName: "shared", Organization: []string{"Example"}}, "audit"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				client, found := ClientForCertificate(&x509.Certificate{Subject: test.subject})
+				if client != test.client || found != (test.client != "") {
+					t.Fatalf("client %q, %v, expected %q", client, found, test.client)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/jwt-service/settings"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Client authentication methods supported by the OAuth endpoints
+const (
+	AuthMethodSecretBasic   = "client_secret_basic"
+	AuthMethodSecretPost    = "client_secret_post"
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+// ClientAssertionType is the only assertion type accepted for private_key_jwt (RFC 7523)
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+const (
+	maxAssertionLifetime  = 5 * time.Minute
+	assertionReplayPrefix = "assertion:"
+)
+
+// ErrInvalidClient is returned when the client cannot be authenticated
+var ErrInvalidClient = errors.New("Client authentication failed")
+
+// assertion keys already loaded, by file path
+var assertionKeys sync.Map
+
+// cache keeping the assertions and signatures used, so they cannot be replayed
+var replays cache.Connector
+
+// Init sets the cache where the client assertions and caller signatures are
+// kept while they are valid
+func Init(cacheConnector cache.Connector) {
+	replays = cacheConnector
+}
+
+// firstUse keeps the key in the replay cache until the expiration, returning
+// false when it was already there
+func firstUse(ctx context.Context, key string, expiration time.Time) bool {
+	ttl := time.Until(expiration)
+	if ttl <= 0 || replays == nil {
+		return false
+	}
+
+	first, err := replays.SetIfNotExists(ctx, key, "1", ttl)
+	return err == nil && first
+}
+
+// Authenticate identifies the client calling an OAuth endpoint, using HTTP Basic
+// or form-encoded client secrets, or a signed client assertion. The request
+// form must be already parsed. It returns the client ID and the method used.
+func Authenticate(r *http.Request) (clientID string, method string, err error) {
+
+	if assertion := r.PostForm.Get("client_assertion"); assertion != "" {
+		if r.PostForm.Get("client_assertion_type") != ClientAssertionType {
+			return "", "", ErrInvalidClient
+		}
+
+		clientID, err = verifyAssertion(r.Context(), assertion, r.PostForm.Get("client_id"))
+		return clientID, AuthMethodPrivateKeyJWT, err
+	}
+
+	secret := ""
+	if id, password, ok := r.BasicAuth(); ok {
+		clientID, secret, method = id, password, AuthMethodSecretBasic
+	} else {
+		clientID, secret, method = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), AuthMethodSecretPost
+	}
+
+	if clientID == "" || secret == "" || !VerifySecret(clientID, secret) {
+		return "", "", ErrInvalidClient
+	}
+
+	return clientID, method, nil
+}
+
+// VerifySecret checks the secret against the bcrypt hashes configured for the
+// client. Several hashes can be configured to allow secret rotation.
+func VerifySecret(clientID string, secret string) bool {
+	for _, hash := range settings.GetClient(clientID).SecretHashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAssertion validates a client assertion signed with the key registered
+// for the client. Issuer and subject must be the client ID, and the audience
+// the issuer or token endpoint of this service, so assertions are rejected
+// when the issuer is not set. Each assertion is accepted once.
+func verifyAssertion(ctx context.Context, assertion string, formClientID string) (clientID string, err error) {
+
+	claims := jwt.MapClaims{}
+	token, errParse := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		clientID, _ = claims["sub"].(string)
+		if clientID == "" || claims["iss"] != clientID || (formClientID != "" && formClientID != clientID) {
+			return nil, ErrInvalidClient
+		}
+
+		keyFile := settings.GetClient(clientID).AssertionKey
+		if keyFile == "" {
+			return nil, ErrInvalidClient
+		}
+
+		return loadAssertionKey(keyFile, token.Method)
+	})
+
+	if errParse != nil || !token.Valid {
+		return "", ErrInvalidClient
+	}
+
+	// short lived assertions only
+	exp, _ := claims["exp"].(float64)
+	if exp == 0 || time.Unix(int64(exp), 0).After(time.Now().Add(maxAssertionLifetime)) {
+		return "", ErrInvalidClient
+	}
+
+	issuer := strings.TrimSuffix(settings.Get().JWT.Issuer, "/")
+	if issuer == "" || !HasAudience(claims, settings.Get().JWT.Issuer, issuer, issuer+"/oauth/token") {
+		return "", ErrInvalidClient
+	}
+
+	// assertions are kept until they expire
+	jti, _ := claims["jti"].(string)
+	if jti == "" || !firstUse(ctx, assertionReplayPrefix+clientID+":"+jti, time.Unix(int64(exp), 0)) {
+		return "", ErrInvalidClient
+	}
+
+	return clientID, nil
+}
+
+// HasAudience returns true if the aud claim, as a string or an array, contains
+// any of the values
+func HasAudience(claims jwt.MapClaims, values ...string) bool {
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for i := range aud {
+			if s, ok := aud[i].(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	for i := range audiences {
+		for k := range values {
+			if values[k] != "" && audiences[i] == values[k] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadAssertionKey returns the public key in the file, checking it matches the
+// signing method of the assertion
+func loadAssertionKey(path string, method jwt.SigningMethod) (key interface{}, err error) {
+	if cached, exists := assertionKeys.Load(path); exists {
+		key = cached
+	} else {
+		pemBytes, errRead := ioutil.ReadFile(path)
+		if errRead != nil {
+			return nil, fmt.Errorf("Error reading assertion key: %s", errRead)
+		}
+
+		if key, err = jwt.ParseRSAPublicKeyFromPEM(pemBytes); err != nil {
+			if key, err = jwt.ParseECPublicKeyFromPEM(pemBytes); err != nil {
+				return nil, fmt.Errorf("Error parsing assertion key %s: %s", path, err)
+			}
+		}
+		assertionKeys.Store(path, key)
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return nil, ErrInvalidClient
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			return nil, ErrInvalidClient
+		}
+	default:
+		return nil, ErrInvalidClient
+	}
+
+	return key, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/core/cache/memory"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testIssuer = "https://auth.example.com"
+
+// assertionKey returns a new RSA key, with its public key saved in a file
+func assertionKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "assertion.pub")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+// initReplays sets a new cache for the assertions used
+func initReplays(t *testing.T) {
+	t.Helper()
+
+	replayCache := new(memory.Cache)
+	replayCache.Init()
+	Init(replayCache)
+	t.Cleanup(func() { Init(nil) })
+}
+
+// signAssertion signs the claims, with a new jti unless it is set
+func signAssertion(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	if _, exists := claims["jti"]; !exists {
+		claims["jti"] = uuid.New().String()
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assertion
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, keyFile := assertionKey(t)
+
+	settings.LoadForTest(t, fmt.Sprintf(`
+jwt:
+  issuer: %s
+clients:
+  test:
+    secret_hashes: ["%s"]
+  signer:
+    assertion_key: %s
+`, testIssuer, hash, keyFile))
+	initReplays(t)
+
+	assertion := func(claims jwt.MapClaims) string {
+		return signAssertion(t, key, claims)
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+	replayed := assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": exp})
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		user     string
+		password string
+		client   string
+		method   string
+	}{
+		{name: "basic", user: "test", password: "secret", client: "test", method: AuthMethodSecretBasic},
+		{name: "basic wrong secret", user: "test", password: "wrong"},
+		{name: "basic unknown client", user: "other", password: "secret"},
+		{name: "post", form: url.Values{"client_id": {"test"}, "client_secret": {"secret"}}, client: "test", method: AuthMethodSecretPost},
+		{name: "post without secret", form: url.Values{"client_id": {"test"}}},
+		{name: "no credentials", form: url.Values{}},
+		{
+			name: "assertion",
+			form: url.Values{
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": exp})},
+			},
+			client: "signer",
+			method: AuthMethodPrivateKeyJWT,
+		},
+		{
+			name: "assertion for the token endpoint",
+			form: url.Values{
+				"client_id":             {"signer"},
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer + "/oauth/token", "exp": exp})},
+			},
+			client: "signer",
+			method: AuthMethodPrivateKeyJWT,
+		},
+		{
+			name:   "assertion used",
+			form:   url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {replayed}},
+			client: "signer",
+			method: AuthMethodPrivateKeyJWT,
+		},
+		{
+			// runs after the assertion was used
+			name: "assertion replayed",
+			form: url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {replayed}},
+		},
+		{
+			name: "assertion without jti",
+			form: url.Values{
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": exp, "jti": nil})},
+			},
+		},
+		{
+			name: "assertion of another client",
+			form: url.Values{
+				"client_id":             {"test"},
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": exp})},
+			},
+		},
+		{
+			name: "assertion type",
+			form: url.Values{
+				"client_assertion_type": {"urn:example"},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": exp})},
+			},
+		},
+		{
+			name: "assertion audience",
+			form: url.Values{
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": "https://other.example.com", "exp": exp})},
+			},
+		},
+		{
+			name: "assertion lifetime",
+			form: url.Values{
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": testIssuer, "exp": time.Now().Add(time.Hour).Unix()})},
+			},
+		},
+		{
+			name: "assertion without key",
+			form: url.Values{
+				"client_assertion_type": {ClientAssertionType},
+				"client_assertion":      {assertion(jwt.MapClaims{"iss": "test", "sub": "test", "aud": testIssuer, "exp": exp})},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(test.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.user != "" {
+				r.SetBasicAuth(test.user, test.password)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+
+			client, method, err := Authenticate(r)
+			if test.client == "" {
+				if err != ErrInvalidClient {
+					t.Errorf("authenticated %q, expected %v", client, ErrInvalidClient)
+				}
+				return
+			}
+
+			if err != nil || client != test.client || method != test.method {
+				t.Errorf("got %q, %q, %v, expected %q, %q", client, method, err, test.client, test.method)
+			}
+		})
+	}
+}
+
+func TestAssertionWithoutIssuer(t *testing.T) {
+	key, keyFile := assertionKey(t)
+	settings.LoadForTest(t, "clients:\n  signer:\n    assertion_key: "+keyFile+"\n")
+	initReplays(t)
+
+	// the token endpoint cannot be identified without the issuer
+	for _, audience := range []string{"/oauth/token", ""} {
+		assertion := signAssertion(t, key, jwt.MapClaims{"iss": "signer", "sub": "signer", "aud": audience, "exp": time.Now().Add(time.Minute).Unix()})
+		if client, err := verifyAssertion(context.Background(), assertion, ""); err != ErrInvalidClient {
+			t.Errorf("audience %q authenticated %q", audience, client)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package enrichment looks up the claims of a subject in the user directory
+// configured for a client, so they are added to the tokens generated for it
+package enrichment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// Sources of claims
+const (
+	SourceFile   = "file"   // JSON or YAML file
+	SourceSQLite = "sqlite" // query on a SQLite database
+	SourceHTTP   = "http"   // webhook to a local service
+)
+
+const defaultTimeout = 2 * time.Second
+
+// claims that are managed by the service and never taken from the directory
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true,
+	"scope": true, "client_id": true, "act": true, "cnf": true,
+}
+
+// Source looks up the claims of a subject. Unknown subjects have no claims.
+type Source interface {
+	Lookup(ctx context.Context, sub string) (map[string]interface{}, error)
+	Close() error
+}
+
+// sources by client ID
+var sources map[string]Source
+
+// Init opens the enrichment sources configured for the clients
+func Init() error {
+	opened := make(map[string]Source)
+	for client, clientSettings := range settings.Get().Clients {
+		if clientSettings == nil || clientSettings.Enrichment.Source == "" {
+			continue
+		}
+
+		source, err := newSource(&clientSettings.Enrichment)
+		if err != nil {
+			closeSources(opened)
+			return fmt.Errorf("Cannot open enrichment source for client %s: %s", client, err)
+		}
+		opened[client] = source
+	}
+
+	sources = opened
+	return nil
+}
+
+func newSource(conf *settings.Enrichment) (Source, error) {
+	switch conf.Source {
+	case SourceFile:
+		return newFileSource(conf.Path)
+	case SourceSQLite:
+		return newSQLiteSource(conf.Path, conf.Query)
+	case SourceHTTP:
+		return newHTTPSource(conf.URL)
+	default:
+		return nil, fmt.Errorf("Unknown source %q", conf.Source)
+	}
+}
+
+// Claims returns the claims of the subject in the directory of the client,
+// restricted to the ones allowed in the configuration
+func Claims(ctx context.Context, client string, sub string) (claims map[string]interface{}, err error) {
+	source, exists := sources[client]
+	if !exists || sub == "" {
+		return nil, nil
+	}
+
+	conf := settings.GetClient(client).Enrichment
+	timeout := defaultTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Millisecond
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	found, err := source.Lookup(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	claims = make(map[string]interface{}, len(found))
+	for name, value := range found {
+		if !reservedClaims[name] && allowed(name, conf.Claims) {
+			claims[name] = value
+		}
+	}
+	return claims, nil
+}
+
+func allowed(name string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for i := range names {
+		if names[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the enrichment sources
+func Close() {
+	closeSources(sources)
+	sources = nil
+}
+
+func closeSources(opened map[string]Source) {
+	for _, source := range opened {
+		source.Close()
+	}
+}
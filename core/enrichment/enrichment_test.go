@@ -0,0 +1,106 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// initFile opens a file source with the subjects for the client test
+func initFile(t *testing.T, subjects string, options string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "users.yml")
+	if err := ioutil.WriteFile(path, []byte(subjects), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	settings.LoadForTest(t, fmt.Sprintf("clients:\n  test:\n    enrichment:\n      source: file\n      path: %s\n%s", path, options))
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Close)
+}
+
+func TestClaims(t *testing.T) {
+	subjects := `
+user:
+  roles: [admin]
+  tenant: acme
+  scope: admin
+  cnf: {jkt: attacker}
+  exp: 4102444800
+  iss: https://attacker.example.com
+  client_id: other
+`
+
+	tests := []struct {
+		name     string
+		options  string
+		client   string
+		sub      string
+		expected map[string]interface{}
+	}{
+		{"reserved claims removed", "", "test", "user",
+			map[string]interface{}{"roles": []interface{}{"admin"}, "tenant": "acme"}},
+		{"allowed claims", "      claims: [tenant, scope]\n", "test", "user",
+			map[string]interface{}{"tenant": "acme"}},
+		{"unknown subject", "", "test", "other", map[string]interface{}{}},
+		{"without subject", "", "test", "", nil},
+		{"client without source", "", "other", "user", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initFile(t, subjects, test.options)
+
+			claims, err := Claims(context.Background(), test.client, test.sub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(claims, test.expected) {
+				t.Errorf("claims %v, expected %v", claims, test.expected)
+			}
+		})
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		enrichment string
+	}{
+		{"unknown source", "source: ldap"},
+		{"missing file", "source: file\n      path: missing.json"},
+		{"invalid url", "source: http\n      url: ftp://127.0.0.1/claims"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, "clients:\n  test:\n    enrichment:\n      "+test.enrichment+"\n")
+			if err := Init(); err == nil {
+				Close()
+				t.Error("source opened")
+			}
+		})
+	}
+}
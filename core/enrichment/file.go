@@ -0,0 +1,130 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fileSource reads the claims from a JSON or YAML file with the subjects as
+// keys. The file is loaded again when it changes.
+type fileSource struct {
+	sync.RWMutex
+	path     string
+	modified time.Time
+	subjects map[string]map[string]interface{}
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	source := &fileSource{path: path}
+	if err := source.load(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Lookup implements Source
+func (s *fileSource) Lookup(ctx context.Context, sub string) (map[string]interface{}, error) {
+	if info, err := os.Stat(s.path); err == nil {
+		s.RLock()
+		changed := info.ModTime().After(s.modified)
+		s.RUnlock()
+
+		if changed {
+			if err = s.load(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	return s.subjects[sub], nil
+}
+
+// Close implements Source
+func (s *fileSource) Close() error {
+	return nil
+}
+
+func (s *fileSource) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	subjects := make(map[string]map[string]interface{})
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yml", ".yaml":
+		var raw map[string]map[string]interface{}
+		if err = yaml.Unmarshal(content, &raw); err != nil {
+			return err
+		}
+		for sub, claims := range raw {
+			subjects[sub] = jsonCompatible(claims).(map[string]interface{})
+		}
+	default:
+		if err = json.Unmarshal(content, &subjects); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	s.subjects = subjects
+	s.modified = info.ModTime()
+	s.Unlock()
+	return nil
+}
+
+// jsonCompatible converts the maps decoded from YAML, so the claims can be
+// encoded as JSON
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if name, ok := key.(string); ok {
+				converted[name] = jsonCompatible(item)
+			}
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = jsonCompatible(item)
+		}
+		return converted
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonCompatible(v[i])
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONCompatible(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"scalar", "acme", "acme"},
+		{"yaml map", map[interface{}]interface{}{"tenant": "acme", 1: "dropped"},
+			map[string]interface{}{"tenant": "acme"}},
+		{"nested maps", map[string]interface{}{"address": map[interface{}]interface{}{"city": "Rosario"}},
+			map[string]interface{}{"address": map[string]interface{}{"city": "Rosario"}}},
+		{"maps in lists", []interface{}{map[interface{}]interface{}{"id": 1}, "admin"},
+			[]interface{}{map[string]interface{}{"id": 1}, "admin"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converted := jsonCompatible(test.value)
+			if !reflect.DeepEqual(converted, test.expected) {
+				t.Errorf("converted %#v, expected %#v", converted, test.expected)
+			}
+			if _, err := json.Marshal(converted); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"json", "users.json", `{"user": {"tenant": "acme", "address": {"city": "Rosario"}}}`},
+		{"yaml", "users.yml", "user:\n  tenant: acme\n  address:\n    city: Rosario\n"},
+	}
+
+	expected := map[string]interface{}{"tenant": "acme", "address": map[string]interface{}{"city": "Rosario"}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if err := ioutil.WriteFile(path, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			source, err := newFileSource(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := source.Lookup(context.Background(), "user")
+			if err != nil || !reflect.DeepEqual(claims, expected) {
+				t.Errorf("claims %v, %v, expected %v", claims, err, expected)
+			}
+		})
+	}
+}
+
+func TestFileSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := ioutil.WriteFile(path, []byte(`{"user": {"tenant": "acme"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := newFileSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		content  string
+		expected interface{}
+		valid    bool
+	}{
+		{"changed", `{"user": {"tenant": "other"}}`, "other", true},
+		{"not valid", `{"user": `, nil, false},
+		{"fixed", `{"user": {"tenant": "fixed"}}`, "fixed", true},
+	}
+
+	for i, step := range steps {
+		if err := ioutil.WriteFile(path, []byte(step.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// file systems with a coarse modification time would not notice the change
+		modified := time.Now().Add(time.Duration(i+1) * time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := source.Lookup(context.Background(), "user")
+		if valid := err == nil; valid != step.valid {
+			t.Errorf("%s: valid = %v, expected %v: %v", step.name, valid, step.valid, err)
+		}
+		if step.valid && claims["tenant"] != step.expected {
+			t.Errorf("%s: tenant %v, expected %v", step.name, claims["tenant"], step.expected)
+		}
+	}
+}
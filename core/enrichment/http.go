@@ -0,0 +1,87 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const maxResponseSize = 1 << 20
+
+// httpSource reads the claims from a local service, requesting the URL with
+// the subject in the 'sub' query parameter. The service answers with a JSON
+// object, or 404 for unknown subjects.
+type httpSource struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func newHTTPSource(rawURL string) (*httpSource, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid URL %q", rawURL)
+	}
+
+	// the directory is a local service, so the proxy is not used
+	return &httpSource{url: parsed, client: &http.Client{}}, nil
+}
+
+// Lookup implements Source
+func (s *httpSource) Lookup(ctx context.Context, sub string) (map[string]interface{}, error) {
+	lookupURL := *s.url
+	query := lookupURL.Query()
+	query.Set("sub", sub)
+	lookupURL.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, lookupURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := s.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unexpected status %d from %s", response.StatusCode, s.url.Host)
+	}
+
+	var claims map[string]interface{}
+	if err = json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Close implements Source
+func (s *httpSource) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("sub") {
+		case "user":
+			w.Write([]byte(`{"tenant": "acme"}`))
+		case "large":
+			w.Write([]byte(`{"tenant": "` + strings.Repeat("a", maxResponseSize) + `"}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source, err := newHTTPSource(server.URL + "/claims?realm=test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	tests := []struct {
+		sub    string
+		tenant interface{}
+		valid  bool
+	}{
+		{"user", "acme", true},
+		{"unknown", nil, true},
+		{"large", nil, false},
+		{"broken", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sub, func(t *testing.T) {
+			claims, err := source.Lookup(context.Background(), test.sub)
+			if valid := err == nil; valid != test.valid {
+				t.Errorf("valid = %v, expected %v: %v", valid, test.valid, err)
+			}
+			if claims["tenant"] != test.tenant {
+				t.Errorf("tenant %v, expected %v", claims["tenant"], test.tenant)
+			}
+		})
+	}
+}
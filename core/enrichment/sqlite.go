@@ -0,0 +1,116 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+// +build cgo
+
+package enrichment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // database/sql driver
+)
+
+// sqliteSource reads the claims from a query on a SQLite database, with the
+// subject as its only parameter. Columns are the claim names, and text values
+// holding a JSON array or object are decoded. The driver needs cgo, see
+// sqlite_nocgo.go for builds without it.
+type sqliteSource struct {
+	db    *sql.DB
+	query *sql.Stmt
+}
+
+func newSQLiteSource(path string, query string) (*sqliteSource, error) {
+	if query == "" {
+		return nil, fmt.Errorf("No query defined")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteSource{db: db, query: stmt}, nil
+}
+
+// Lookup implements Source
+func (s *sqliteSource) Lookup(ctx context.Context, sub string) (map[string]interface{}, error) {
+	rows, err := s.query.QueryContext(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	if err = rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{}, len(columns))
+	for i := range columns {
+		if values[i] != nil {
+			claims[columns[i]] = claimValue(values[i])
+		}
+	}
+	return claims, nil
+}
+
+// Close implements Source
+func (s *sqliteSource) Close() error {
+	s.query.Close()
+	return s.db.Close()
+}
+
+func claimValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	if s, ok := value.(string); ok {
+		trimmed := strings.TrimSpace(s)
+		if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+			var decoded interface{}
+			if json.Unmarshal([]byte(trimmed), &decoded) == nil {
+				return decoded
+			}
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo
+// +build !cgo
+
+package enrichment
+
+import (
+	"fmt"
+)
+
+// newSQLiteSource fails on builds without cgo, which the SQLite driver needs
+func newSQLiteSource(path string, query string) (Source, error) {
+	return nil, fmt.Errorf("SQLite sources are not supported, the service was built without cgo")
+}
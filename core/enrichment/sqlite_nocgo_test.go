@@ -0,0 +1,30 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo
+// +build !cgo
+
+package enrichment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSQLiteWithoutCgo(t *testing.T) {
+	source, err := newSQLiteSource("users.db", "SELECT tenant FROM users WHERE sub = ?")
+	if source != nil || err == nil || !strings.Contains(err.Error(), "without cgo") {
+		t.Errorf("source %v, error %v", source, err)
+	}
+}
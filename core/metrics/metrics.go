@@ -0,0 +1,93 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics holds the Prometheus metrics of the service
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jwt_service"
+
+// Outcome of the operations that succeed. Failed operations use the error code.
+const OutcomeSuccess = "success"
+
+// ClientUnknown is the client label of the requests from clients that are not
+// configured, so they cannot grow the number of series
+const ClientUnknown = "unknown"
+
+// Token operations
+var (
+	TokensIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Token issuance requests, by client, grant and outcome.",
+	}, []string{"client", "grant", "outcome"})
+
+	TokensValidated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_validated_total",
+		Help:      "Token validation requests, by client and outcome.",
+	}, []string{"client", "outcome"})
+
+	TokensDestroyed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_destroyed_total",
+		Help:      "Token destruction and revocation requests, by client, operation and outcome.",
+	}, []string{"client", "operation", "outcome"})
+
+	ValidationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "validation_duration_seconds",
+		Help:      "Time spent validating tokens, by client.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"client"})
+
+	BlacklistFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blacklist_fallbacks_total",
+		Help:      "Validations done while the blacklist was not available, by client and failure policy.",
+	}, []string{"client", "policy"})
+)
+
+// Redis commands
+var (
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Latency of the Redis commands.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .5},
+	}, []string{"command"})
+
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Redis commands failed, including timeouts.",
+	}, []string{"command"})
+)
+
+// Register adds a collector to the metrics served
+func Register(collector prometheus.Collector) error {
+	return prometheus.Register(collector)
+}
+
+// Handler serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
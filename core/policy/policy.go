@@ -0,0 +1,122 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy evaluates the CEL expressions configured for the clients
+// against the claims of the tokens they generate and validate
+package policy
+
+import (
+	"fmt"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/google/cel-go/cel"
+)
+
+// maximum cost of the evaluation of an expression, to bound the time spent on
+// each request
+const costLimit = 100000
+
+// Operations the policies are evaluated for
+const (
+	Generate = "generate"
+	Validate = "validate"
+)
+
+// program is a compiled policy
+type program struct {
+	name    string
+	message string
+	program cel.Program
+}
+
+// compiled policies, by client and operation
+var programs map[string]map[string][]program
+
+// Init compiles the policies of every client, so they are ready to be
+// evaluated. Expressions are evaluated with the variables 'claims' and
+// 'client', and must return a bool.
+func Init() error {
+	env, err := cel.NewEnv(
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("client", cel.StringType),
+	)
+	if err != nil {
+		return err
+	}
+
+	compiled := make(map[string]map[string][]program)
+	for client, clientSettings := range settings.Get().Clients {
+		if clientSettings == nil {
+			continue
+		}
+
+		operations := map[string][]settings.Policy{
+			Generate: clientSettings.Policies.Generate,
+			Validate: clientSettings.Policies.Validate,
+		}
+
+		for operation, policies := range operations {
+			for i := range policies {
+				prg, errCompile := compile(env, policies[i].Rule)
+				if errCompile != nil {
+					return fmt.Errorf("Invalid %s policy '%s' for client %s: %s", operation, policies[i].Name, client, errCompile)
+				}
+
+				if compiled[client] == nil {
+					compiled[client] = make(map[string][]program)
+				}
+				compiled[client][operation] = append(compiled[client][operation], program{
+					name:    policies[i].Name,
+					message: policies[i].Message,
+					program: prg,
+				})
+			}
+		}
+	}
+
+	programs = compiled
+	return nil
+}
+
+func compile(env *cel.Env, rule string) (cel.Program, error) {
+	ast, issues := env.Compile(rule)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	// dyn results are checked when evaluated
+	if !ast.OutputType().IsExactType(cel.BoolType) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("Expression must return a bool, not %s", ast.OutputType())
+	}
+
+	return env.Program(ast, cel.CostLimit(costLimit))
+}
+
+// Evaluate runs the policies of the client for the operation, returning the
+// ones denying the claims. Policies failing to evaluate also deny the claims.
+func Evaluate(client string, operation string, claims map[string]interface{}) (denials []api.PolicyDenial) {
+	vars := map[string]interface{}{"claims": claims, "client": client}
+
+	for _, p := range programs[client][operation] {
+		out, _, err := p.program.Eval(vars)
+		if err != nil {
+			denials = append(denials, api.PolicyDenial{Policy: p.name, Message: p.message, Error: err.Error()})
+		} else if allowed, ok := out.Value().(bool); !ok || !allowed {
+			denials = append(denials, api.PolicyDenial{Policy: p.name, Message: p.message})
+		}
+	}
+
+	return
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestEvaluate(t *testing.T) {
+	settings.LoadForTest(t, `
+clients:
+  test:
+    policies:
+      generate:
+        - name: role
+          rule: "has(claims.role) && claims.role in ['admin', 'user']"
+          message: role must be admin or user
+        - name: own client
+          rule: "!has(claims.client_id) || claims.client_id == client"
+      validate:
+        - name: tenant
+          rule: "claims.tenant"
+`)
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		client    string
+		operation string
+		claims    map[string]interface{}
+		denied    []string
+		errors    bool
+	}{
+		{name: "allowed", client: "test", operation: Generate, claims: map[string]interface{}{"role": "user"}},
+		{name: "denied", client: "test", operation: Generate, claims: map[string]interface{}{"role": "guest"}, denied: []string{"role"}},
+		{name: "all denials", client: "test", operation: Generate, claims: map[string]interface{}{"client_id": "other"}, denied: []string{"role", "own client"}},
+		{name: "other operation", client: "test", operation: Validate, claims: map[string]interface{}{"role": "guest", "tenant": true}},
+		{name: "not a bool", client: "test", operation: Validate, claims: map[string]interface{}{"tenant": "acme"}, denied: []string{"tenant"}},
+		{name: "failing evaluation", client: "test", operation: Validate, claims: map[string]interface{}{}, denied: []string{"tenant"}, errors: true},
+		{name: "client without policies", client: "other", operation: Generate, claims: map[string]interface{}{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			denials := Evaluate(test.client, test.operation, test.claims)
+			if len(denials) != len(test.denied) {
+				t.Fatalf("%d denials, expected %d: %v", len(denials), len(test.denied), denials)
+			}
+			for i := range denials {
+				if denials[i].Policy != test.denied[i] {
+					t.Errorf("denied by %q, expected %q", denials[i].Policy, test.denied[i])
+				}
+				if errors := denials[i].Error != ""; errors != test.errors {
+					t.Errorf("evaluation error %q", denials[i].Error)
+				}
+			}
+		})
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"syntax", "claims.role =="},
+		{"not a bool", "'admin'"},
+		{"unknown variable", "user == 'admin'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, "clients:\n  test:\n    policies:\n      generate:\n        - name: invalid\n          rule: \""+test.rule+"\"\n")
+			if err := Init(); err == nil {
+				t.Error("invalid policy compiled")
+			}
+		})
+	}
+}
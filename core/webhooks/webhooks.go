@@ -0,0 +1,295 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhooks delivers the token lifecycle events to the configured
+// endpoints. Events are signed with HMAC-SHA256 and delivered asynchronously,
+// with retries. Each endpoint has its own queue, so the retries of an endpoint
+// down do not delay the others. Events that cannot be delivered go to a
+// dead-letter file.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/fcoders/logger"
+	"github.com/google/uuid"
+)
+
+// Token lifecycle events
+const (
+	EventGenerated        = "token.generated"
+	EventDestroyed        = "token.destroyed"
+	EventRevoked          = "token.revoked"
+	EventValidationFailed = "token.validation_failed"
+)
+
+// Headers sent with the deliveries. The signature is the hex HMAC-SHA256 of
+// the timestamp, a dot and the body.
+const (
+	HeaderEvent     = "Webhook-Event"
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+const (
+	defaultQueueSize     = 1000
+	defaultRetries       = 5
+	defaultRetryInterval = time.Second
+	defaultTimeout       = 5 * time.Second
+)
+
+// delivery is an event pending to be sent to an endpoint
+type delivery struct {
+	endpoint *settings.WebhookEndpoint
+	event    api.LifecycleEvent
+	body     []byte
+}
+
+type dispatcher struct {
+	endpoints []settings.WebhookEndpoint
+	queues    []chan delivery // of each endpoint
+	ctx       context.Context
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	deadLock  sync.Mutex
+}
+
+// active dispatcher, nil when webhooks are disabled or stopped
+var (
+	active      *dispatcher
+	activeMutex sync.RWMutex
+)
+
+// Init starts the delivery of the events, when webhooks are enabled
+func Init() error {
+	conf := settings.Get().Webhooks
+	if !conf.Enabled {
+		return nil
+	}
+
+	for i := range conf.Endpoints {
+		if conf.Endpoints[i].URL == "" || conf.Endpoints[i].Secret == "" {
+			return fmt.Errorf("Webhook endpoints need an URL and a secret")
+		}
+	}
+
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	d := &dispatcher{endpoints: conf.Endpoints, queues: make([]chan delivery, len(conf.Endpoints))}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	// one worker per endpoint, delivering its events in order
+	for i := range d.queues {
+		d.queues[i] = make(chan delivery, queueSize)
+		d.workers.Add(1)
+		go d.run(d.queues[i])
+	}
+
+	activeMutex.Lock()
+	active = d
+	activeMutex.Unlock()
+	return nil
+}
+
+// Stop ends the delivery of the events. Events not delivered yet are written
+// to the dead-letter file.
+func Stop() {
+	activeMutex.Lock()
+	d := active
+	active = nil
+	if d != nil {
+		d.cancel()
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	activeMutex.Unlock()
+
+	if d != nil {
+		d.workers.Wait()
+	}
+}
+
+// Notify queues the event for the endpoints subscribed to it. It never blocks,
+// events are sent to the dead-letter file when the queue is full.
+func Notify(event api.LifecycleEvent) {
+	activeMutex.RLock()
+	defer activeMutex.RUnlock()
+
+	d := active
+	if d == nil {
+		return
+	}
+
+	event.ID = uuid.New().String()
+	event.Time = time.Now().Unix()
+	body, _ := json.Marshal(event)
+
+	for i := range d.endpoints {
+		if !subscribed(&d.endpoints[i], event.Type) {
+			continue
+		}
+
+		pending := delivery{endpoint: &d.endpoints[i], event: event, body: body}
+		select {
+		case d.queues[i] <- pending:
+		default:
+			d.deadLetter(pending, fmt.Errorf("Queue full"))
+		}
+	}
+}
+
+func subscribed(endpoint *settings.WebhookEndpoint, eventType string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for i := range endpoint.Events {
+		if endpoint.Events[i] == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dispatcher) run(queue chan delivery) {
+	defer d.workers.Done()
+	for pending := range queue {
+		if err := d.deliver(pending); err != nil {
+			d.deadLetter(pending, err)
+		}
+	}
+}
+
+// deliver sends the event, retrying with an exponential backoff
+func (d *dispatcher) deliver(pending delivery) (err error) {
+	conf := settings.Get().Webhooks
+
+	retries := conf.Retries
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+
+	wait := defaultRetryInterval
+	if conf.RetryInterval > 0 {
+		wait = time.Duration(conf.RetryInterval) * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err = d.send(pending); err == nil {
+			return nil
+		}
+
+		if attempt >= retries {
+			return
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return fmt.Errorf("Stopped before delivery: %s", err)
+		case <-time.After(wait):
+			wait *= 2
+		}
+	}
+}
+
+func (d *dispatcher) send(pending delivery) error {
+	if d.ctx.Err() != nil {
+		return d.ctx.Err()
+	}
+
+	timeout := defaultTimeout
+	if t := settings.Get().Webhooks.Timeout; t > 0 {
+		timeout = time.Duration(t) * time.Millisecond
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodPost, pending.endpoint.URL, bytes.NewReader(pending.body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, pending.event.Type)
+	request.Header.Set(HeaderID, pending.event.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderSignature, "sha256="+Sign(pending.endpoint.Secret, timestamp, pending.body))
+
+	response, err := settings.GetHTTPClient().Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Endpoint answered with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a delivery
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter appends the event that could not be delivered to the dead-letter
+// file, as a JSON line
+func (d *dispatcher) deadLetter(pending delivery, cause error) {
+	path := settings.Get().Webhooks.DeadLetterFile
+	logger.GetLogger().Infof("Webhook %s not delivered to %s: %s", pending.event.ID, pending.endpoint.URL, cause)
+	if path == "" {
+		return
+	}
+
+	line, _ := json.Marshal(struct {
+		URL   string             `json:"url"`
+		Error string             `json:"error"`
+		Event api.LifecycleEvent `json:"event"`
+	}{pending.endpoint.URL, cause.Error(), pending.event})
+
+	d.deadLock.Lock()
+	defer d.deadLock.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.GetLogger().Infof("Cannot open webhooks dead-letter file: %s", err)
+		return
+	}
+	defer file.Close()
+
+	file.Write(append(line, '\n'))
+}
@@ -0,0 +1,306 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhooks
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// endpoint is a webhook receiver answering with the status returned by the
+// handler for each attempt
+type endpoint struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	attempts []*http.Request
+	bodies   [][]byte
+	times    []time.Time
+	received chan struct{}
+}
+
+func newEndpoint(t *testing.T, status func(attempt int, r *http.Request) int) *endpoint {
+	e := &endpoint{received: make(chan struct{}, 100)}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		e.mutex.Lock()
+		e.attempts = append(e.attempts, r)
+		e.bodies = append(e.bodies, body)
+		e.times = append(e.times, time.Now())
+		attempt := len(e.attempts)
+		e.mutex.Unlock()
+
+		w.WriteHeader(status(attempt, r))
+		e.received <- struct{}{}
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+// wait blocks until the endpoint receives n more requests
+func (e *endpoint) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-e.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("endpoint received %d requests, expected %d", i, n)
+		}
+	}
+}
+
+func ok(int, *http.Request) int     { return http.StatusOK }
+func failed(int, *http.Request) int { return http.StatusInternalServerError }
+
+// start enables the webhooks for the endpoints, returning the dead-letter file
+func start(t *testing.T, options string, endpoints ...*endpoint) string {
+	t.Helper()
+
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	content := fmt.Sprintf("webhooks:\n  enabled: yes\n  dead_letter_file: %s\n%s  endpoints:\n", deadLetter, options)
+	for _, e := range endpoints {
+		content += fmt.Sprintf("    - url: %s\n      secret: secret\n", e.URL)
+	}
+
+	settings.LoadForTest(t, content)
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Stop)
+	return deadLetter
+}
+
+// deadLetters returns the events written to the dead-letter file
+func deadLetters(t *testing.T, path string) (events []api.LifecycleEvent) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line struct {
+			URL   string             `json:"url"`
+			Error string             `json:"error"`
+			Event api.LifecycleEvent `json:"event"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.URL == "" || line.Error == "" {
+			t.Fatalf("dead letter %q: %v", scanner.Text(), err)
+		}
+		events = append(events, line.Event)
+	}
+	return events
+}
+
+func TestSignature(t *testing.T) {
+	e := newEndpoint(t, ok)
+	start(t, "", e)
+
+	Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test", Subject: "user", JTI: "jti"})
+	e.wait(t, 1)
+
+	request, body := e.attempts[0], e.bodies[0]
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(request.Header.Get(HeaderTimestamp) + "." + string(body)))
+	if signature := request.Header.Get(HeaderSignature); signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature %q does not match the body", signature)
+	}
+
+	var event api.LifecycleEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventRevoked || event.JTI != "jti" || event.ID == "" || event.Time == 0 {
+		t.Errorf("event %+v", event)
+	}
+	if request.Header.Get(HeaderEvent) != EventRevoked || request.Header.Get(HeaderID) != event.ID {
+		t.Errorf("headers %v do not match the event", request.Header)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	e := newEndpoint(t, ok)
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	settings.LoadForTest(t, fmt.Sprintf("webhooks:\n  enabled: yes\n  dead_letter_file: %s\n  endpoints:\n"+
+		"    - url: %s\n      secret: secret\n      events: [%s]\n", deadLetter, e.URL, EventRevoked))
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Stop)
+
+	Notify(api.LifecycleEvent{Type: EventGenerated, Client: "test"})
+	Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test"})
+	e.wait(t, 1)
+	Stop()
+
+	if len(e.attempts) != 1 || e.attempts[0].Header.Get(HeaderEvent) != EventRevoked {
+		t.Errorf("%d events delivered, expected the %s event only", len(e.attempts), EventRevoked)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    func(int, *http.Request) int
+		attempts  int
+		delivered bool
+	}{
+		{"delivered after failing", func(attempt int, r *http.Request) int {
+			if attempt < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusNoContent
+		}, 3, true},
+		{"given up", failed, 4, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newEndpoint(t, test.status)
+			deadLetter := start(t, "  retries: 3\n  retry_interval: 20\n", e)
+
+			Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test"})
+			e.wait(t, test.attempts)
+
+			// let the worker read the last answer before stopping
+			time.Sleep(50 * time.Millisecond)
+			Stop()
+
+			if len(e.attempts) != test.attempts {
+				t.Errorf("%d attempts, expected %d", len(e.attempts), test.attempts)
+			}
+
+			// the interval is doubled after each attempt
+			wait := 20 * time.Millisecond
+			for i := 1; i < len(e.times); i++ {
+				if elapsed := e.times[i].Sub(e.times[i-1]); elapsed < wait {
+					t.Errorf("attempt %d after %s, expected %s", i+1, elapsed, wait)
+				}
+				wait *= 2
+			}
+
+			if delivered := len(deadLetters(t, deadLetter)) == 0; delivered != test.delivered {
+				t.Errorf("delivered = %v, expected %v", delivered, test.delivered)
+			}
+		})
+	}
+}
+
+func TestEndpointsIndependent(t *testing.T) {
+	down := newEndpoint(t, failed)
+	up := newEndpoint(t, ok)
+	start(t, "  retries: 5\n  retry_interval: 1000\n", down, up)
+
+	// retries to the endpoint down must not delay the deliveries to the other
+	for i := 0; i < 10; i++ {
+		Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test"})
+	}
+
+	start := time.Now()
+	up.wait(t, 10)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("events delivered after %s", elapsed)
+	}
+}
+
+func TestStopDrains(t *testing.T) {
+	release := make(chan struct{})
+	e := newEndpoint(t, func(attempt int, r *http.Request) int {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		return http.StatusOK
+	})
+	defer close(release)
+
+	deadLetter := start(t, "  timeout: 10000\n", e)
+
+	ids := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test", JTI: fmt.Sprint(i)})
+		ids[fmt.Sprint(i)] = true
+	}
+
+	// wait for the first delivery to be in flight, the rest stay queued
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	events := deadLetters(t, deadLetter)
+	for _, event := range events {
+		delete(ids, event.JTI)
+	}
+	if len(ids) > 0 || len(events) != 5 {
+		t.Errorf("%d events in the dead-letter file, missing %v", len(events), ids)
+	}
+
+	// no events are queued once stopped
+	Notify(api.LifecycleEvent{Type: EventRevoked, Client: "test"})
+	if events := deadLetters(t, deadLetter); len(events) != 5 {
+		t.Errorf("%d events in the dead-letter file after stopping", len(events))
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+	}{
+		{"without url", "    - secret: secret\n"},
+		{"without secret", "    - url: http://localhost\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, "webhooks:\n  enabled: yes\n  endpoints:\n"+test.endpoint)
+			if err := Init(); err == nil || !strings.Contains(err.Error(), "URL and a secret") {
+				Stop()
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
@@ -16,18 +16,29 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 
 	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/controllers"
+	"github.com/fcoders/jwt-service/core/audit"
 	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/enrichment"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/core/webhooks"
 	"github.com/fcoders/jwt-service/routes"
 	"github.com/fcoders/jwt-service/services"
 	"github.com/fcoders/jwt-service/settings"
 	"github.com/fcoders/logger"
 	"github.com/gin-gonic/gin"
-	"github.com/yvasiyarov/gorelic"
+)
+
+const (
+	defaultMetricsAddress = "127.0.0.1:9100"
+	defaultMetricsPath    = "/metrics"
 )
 
 // HTTPService represents the HTTP service that is initiated when the server starts.
@@ -35,7 +46,6 @@ import (
 type HTTPService struct {
 	engine    *gin.Engine
 	waitGroup *sync.WaitGroup
-	agent     *gorelic.Agent
 }
 
 // Init creates a new instance of the HTTP engine
@@ -49,28 +59,101 @@ func (service *HTTPService) Init() {
 
 	engine := gin.New()
 	engine.Use(gin.Recovery())
-	engine.Use(gin.Logger())
+	// keep the standard output for the audit records when they are written there
+	requestLog := gin.DefaultWriter
+	if audit.UsesStdout() {
+		requestLog = os.Stderr
+	}
+	engine.Use(gin.LoggerWithWriter(requestLog))
+	engine.Use(controllers.CertificateIdentity())
+	engine.Use(controllers.AuditCaller())
 
 	service.engine = engine
 }
 
-// Start starts the HTTP service
-func (service *HTTPService) Start() {
+// Start starts the HTTP service. It fails when the listeners cannot be bound.
+func (service *HTTPService) Start() error {
 
 	routes.InitRoutes(service.engine)
-	port := fmt.Sprintf(":%v", settings.Get().App.HTTPPort)
+	log := logger.GetLogger()
+
+	if settings.Get().App.HTTPPort != 0 {
+		server := &http.Server{
+			Addr:    fmt.Sprintf(":%v", settings.Get().App.HTTPPort),
+			Handler: service.engine,
+		}
+
+		if err := serve(server); err != nil {
+			return fmt.Errorf("Cannot start HTTP listener: %s", err)
+		}
+		log.Infof("HTTP listener started on port %v", settings.Get().App.HTTPPort)
+	}
+
+	if settings.Get().TLS.Enabled {
+		tlsConfig, err := newTLSConfig()
+		if err != nil {
+			return err
+		}
+
+		server := &http.Server{
+			Addr:      fmt.Sprintf(":%v", settings.Get().TLS.Port),
+			Handler:   service.engine,
+			TLSConfig: tlsConfig,
+		}
+
+		if err := serve(server); err != nil {
+			return fmt.Errorf("Cannot start HTTPS listener: %s", err)
+		}
+		log.Infof("HTTPS listener started on port %v", settings.Get().TLS.Port)
+	}
 
-	server := &http.Server{
-		Addr:    port,
-		Handler: service.engine,
+	// metrics are served on their own listener, so they are not exposed with the API
+	if conf := settings.Get().Metrics; conf.Enabled {
+		address, path := conf.Address, conf.Path
+		if address == "" {
+			address = defaultMetricsAddress
+		}
+		if path == "" {
+			path = defaultMetricsPath
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(path, metrics.Handler())
+		if err := serve(&http.Server{Addr: address, Handler: mux}); err != nil {
+			return fmt.Errorf("Cannot start metrics listener: %s", err)
+		}
+		log.Infof("Metrics listener started on %s", address)
 	}
 
-	go server.ListenAndServe()
 	service.waitGroup.Add(1)
 
-	log := logger.GetLogger()
 	log.Infof("%s service started!", settings.AppName)
 	log.Infof("Version %s commit %s", settings.Version, settings.CommitHash)
+	return nil
+}
+
+// serve binds the address of the server and accepts its connections in the
+// background, with TLS when the server has a TLS config
+func serve(server *http.Server) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if server.TLSConfig != nil {
+			// certificates are provided by the TLS config
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if err != http.ErrServerClosed {
+			logger.GetLogger().Infof("Listener on %s stopped: %s", server.Addr, err)
+		}
+	}()
+
+	return nil
 }
 
 // Stop ends the HTTP service execution and release all the resources
@@ -78,7 +161,12 @@ func (service *HTTPService) Stop(cause string) {
 
 	log := services.Get().Logger
 	log.Infof("Shutdown requested with signal '%s'", strings.ToUpper(cause))
-	authentication.CloseCacheConnections()
+	if err := authentication.CloseCacheConnections(); err != nil {
+		log.Infof("Error closing cache connections: %s", err)
+	}
+	enrichment.Close()
+	webhooks.Stop()
+	audit.Close()
 
 	log.Infof("%s service is now ready to exit, bye!", settings.AppName)
 	service.waitGroup.Done()
@@ -21,6 +21,12 @@ import (
 	"path/filepath"
 	"syscall"
 
+	"github.com/fcoders/jwt-service/core/audit"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/fcoders/jwt-service/core/enrichment"
+	"github.com/fcoders/jwt-service/core/policy"
+	"github.com/fcoders/jwt-service/core/webhooks"
 	"github.com/fcoders/jwt-service/services"
 	"github.com/fcoders/jwt-service/settings"
 )
@@ -44,13 +50,53 @@ func appInit() {
 		log.Panicf("Error initiation dependency manager: %s", err.Error())
 	}
 
+	// replay protection of the client credentials
+	clients.Init(services.Get().Cache)
+
+	// signing keys and cache
+	authBackend, err := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+	if err != nil {
+		log.Panicf("Error initializing authentication backend: %s", err.Error())
+	}
+
+	// anyone can generate and destroy the tokens of clients without caller credentials
+	if !settings.Get().App.RequireCallerAuth {
+		for id := range authBackend.Store {
+			if !clients.HasCallerCredentials(id) {
+				services.Get().Logger.Infof("WARNING: caller authentication is disabled and client %s has no caller credentials, its tokens can be generated and destroyed by anyone", id)
+			}
+		}
+	}
+
+	// client policies
+	if err := policy.Init(); err != nil {
+		log.Panicf("Error compiling client policies: %s", err.Error())
+	}
+
+	// claim enrichment sources
+	if err := enrichment.Init(); err != nil {
+		log.Panicf("Error opening enrichment sources: %s", err.Error())
+	}
+
+	// audit trail
+	if err := audit.Init(); err != nil {
+		log.Panicf("Error opening audit trail: %s", err.Error())
+	}
+
+	// token lifecycle webhooks
+	if err := webhooks.Init(); err != nil {
+		log.Panicf("Error starting webhooks: %s", err.Error())
+	}
+
 }
 
 func httpServiceInit() {
 	httpService := HTTPService{}
 	httpService.Init()
 
-	go httpService.Start()
+	if err := httpService.Start(); err != nil {
+		log.Panicf("Error starting HTTP service: %s", err.Error())
+	}
 
 	ch := make(chan os.Signal)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
@@ -27,9 +27,24 @@ func InitRoutes(engine *gin.Engine) {
 	{
 		token := v1.Group("/token")
 		{
-			token.POST("/generate", controllers.Generate())
+			token.POST("/generate", controllers.CallerAuthentication(), controllers.Generate())
 			token.POST("/validate", controllers.Validate())
-			token.POST("/destroy", controllers.Destroy())
+			token.POST("/destroy", controllers.CallerAuthentication(), controllers.Destroy())
+			token.POST("/introspect", controllers.Introspect())
 		}
+
+		v1.GET("/revocations/stream", controllers.CallerAuthentication(), controllers.StreamRevocations())
+	}
+
+	oauth := engine.Group("/oauth")
+	{
+		oauth.POST("/token", controllers.Token())
+		oauth.POST("/revoke", controllers.Revoke())
+	}
+
+	wellKnown := engine.Group("/.well-known")
+	{
+		wellKnown.GET("/openid-configuration", controllers.Discovery())
+		wellKnown.GET("/jwks.json", controllers.JWKS())
 	}
 }
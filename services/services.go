@@ -15,8 +15,11 @@
 package services
 
 import (
+	"time"
+
 	"github.com/fcoders/jwt-service/core/cache"
 	"github.com/fcoders/jwt-service/core/cache/redis"
+	"github.com/fcoders/jwt-service/settings"
 	"github.com/fcoders/logger"
 
 	"github.com/facebookgo/inject"
@@ -55,7 +58,7 @@ func Init() (err error) {
 	logger.SetLogger(log)
 
 	// cache
-	cache := new(redis.Pool)
+	cache := &redis.Pool{Config: redisConfig()}
 
 	// instances for service container
 	var graph inject.Graph
@@ -70,3 +73,33 @@ func Init() (err error) {
 	err = graph.Populate()
 	return
 }
+
+// redisConfig returns the options of the Redis connector from the settings
+func redisConfig() redis.Config {
+	conf := settings.Get().Redis
+	return redis.Config{
+		Mode:              conf.Mode,
+		Address:           conf.Address,
+		Username:          conf.Username,
+		Password:          conf.Password,
+		Database:          conf.Database,
+		MasterName:        conf.Sentinel.MasterName,
+		SentinelAddresses: conf.Sentinel.Addresses,
+		ClusterAddresses:  conf.Cluster.Addresses,
+		TLS: redis.TLSConfig{
+			Enabled:            conf.TLS.Enabled,
+			CAFile:             conf.TLS.CAFile,
+			CertFile:           conf.TLS.CertFile,
+			KeyFile:            conf.TLS.KeyFile,
+			ServerName:         conf.TLS.ServerName,
+			InsecureSkipVerify: conf.TLS.InsecureSkipVerify,
+		},
+		DialTimeout:  time.Duration(conf.Timeouts.Dial) * time.Millisecond,
+		ReadTimeout:  time.Duration(conf.Timeouts.Read) * time.Millisecond,
+		WriteTimeout: time.Duration(conf.Timeouts.Write) * time.Millisecond,
+		MaxIdle:      conf.Pool.MaxIdle,
+		MaxActive:    conf.Pool.MaxActive,
+		IdleTimeout:  time.Duration(conf.Pool.IdleTimeout) * time.Second,
+		Wait:         conf.Pool.Wait,
+	}
+}
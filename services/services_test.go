@@ -0,0 +1,111 @@
+// Copyright 2018 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/core/cache/redis"
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestRedisConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected redis.Config
+	}{
+		{
+			name:     "not configured",
+			settings: "app:\n  http_port: 0\n",
+		},
+		{
+			name: "standalone",
+			settings: `
+redis:
+  address: 127.0.0.1:6379
+  username: jwt
+  password: secret
+  database: 2
+  timeouts:
+    dial: 5000
+    read: 3000
+    write: 2000
+  pool:
+    max_idle: 5
+    max_active: 10
+    idle_timeout: 60
+    wait: yes
+`,
+			expected: redis.Config{
+				Address:      "127.0.0.1:6379",
+				Username:     "jwt",
+				Password:     "secret",
+				Database:     2,
+				DialTimeout:  5 * time.Second,
+				ReadTimeout:  3 * time.Second,
+				WriteTimeout: 2 * time.Second,
+				MaxIdle:      5,
+				MaxActive:    10,
+				IdleTimeout:  time.Minute,
+				Wait:         true,
+			},
+		},
+		{
+			name: "sentinel",
+			settings: `
+redis:
+  mode: sentinel
+  sentinel:
+    master_name: mymaster
+    addresses: [10.0.0.1:26379, 10.0.0.2:26379]
+`,
+			expected: redis.Config{
+				Mode:              redis.ModeSentinel,
+				MasterName:        "mymaster",
+				SentinelAddresses: []string{"10.0.0.1:26379", "10.0.0.2:26379"},
+			},
+		},
+		{
+			name: "cluster with TLS",
+			settings: `
+redis:
+  mode: cluster
+  cluster:
+    addresses: [10.0.0.1:7000]
+  tls:
+    enabled: yes
+    ca_file: ca.pem
+    server_name: redis.internal
+`,
+			expected: redis.Config{
+				Mode:             redis.ModeCluster,
+				ClusterAddresses: []string{"10.0.0.1:7000"},
+				TLS:              redis.TLSConfig{Enabled: true, CAFile: "ca.pem", ServerName: "redis.internal"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, test.settings)
+			if config := redisConfig(); !reflect.DeepEqual(config, test.expected) {
+				t.Errorf("config %+v, expected %+v", config, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/fcoders/jwt-service/api"
+)
+
+// checkAssertions returns the first assertion the claims do not pass, or an
+// error if an assertion is malformed
+func checkAssertions(claims map[string]interface{}, assertions []api.ClaimAssertion) (failed *api.ClaimAssertion, err error) {
+	for i := range assertions {
+		passed, errAssertion := checkAssertion(claims, &assertions[i])
+		if errAssertion != nil {
+			return nil, errAssertion
+		}
+		if !passed {
+			return &assertions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func checkAssertion(claims map[string]interface{}, assertion *api.ClaimAssertion) (bool, error) {
+	if assertion.Claim == "" {
+		return false, fmt.Errorf("Assertion without claim")
+	}
+
+	// missing claims only pass assertions without checks on the value
+	value, exists := claimValue(claims, assertion.Claim)
+	if !exists {
+		return !assertion.Required && !checksValue(assertion), nil
+	}
+
+	if assertion.Equals != nil && !reflect.DeepEqual(value, assertion.Equals) {
+		return false, nil
+	}
+
+	if assertion.In != nil {
+		values, isArray := value.([]interface{})
+		if !isArray {
+			values = []interface{}{value}
+		}
+		for i := range values {
+			if !inSet(values[i], assertion.In) {
+				return false, nil
+			}
+		}
+	}
+
+	if assertion.Matches != "" {
+		pattern, errPattern := regexp.Compile(assertion.Matches)
+		if errPattern != nil {
+			return false, fmt.Errorf("Invalid pattern for claim %s: %s", assertion.Claim, errPattern)
+		}
+
+		s, isString := value.(string)
+		if !isString || !pattern.MatchString(s) {
+			return false, nil
+		}
+	}
+
+	if assertion.Min != nil || assertion.Max != nil {
+		n, isNumber := value.(float64)
+		if !isNumber || (assertion.Min != nil && n < *assertion.Min) || (assertion.Max != nil && n > *assertion.Max) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// checksValue returns true if the assertion has conditions on the claim value
+func checksValue(assertion *api.ClaimAssertion) bool {
+	return assertion.Equals != nil || assertion.In != nil || assertion.Matches != "" ||
+		assertion.Min != nil || assertion.Max != nil
+}
+
+// claimValue returns the claim with the name, following the dots into
+// nested claims
+func claimValue(claims map[string]interface{}, name string) (value interface{}, exists bool) {
+	current := claims
+	path := strings.Split(name, ".")
+	for i := range path {
+		if value, exists = current[path[i]]; !exists {
+			return
+		}
+
+		if i < len(path)-1 {
+			if current, exists = value.(map[string]interface{}); !exists {
+				return
+			}
+		}
+	}
+	return
+}
+
+func inSet(value interface{}, set []interface{}) bool {
+	for i := range set {
+		if reflect.DeepEqual(value, set[i]) {
+			return true
+		}
+	}
+	return false
+}
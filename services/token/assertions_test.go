@@ -0,0 +1,92 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+
+	"github.com/fcoders/jwt-service/api"
+)
+
+func TestCheckAssertion(t *testing.T) {
+	claims := map[string]interface{}{
+		"sub":   "user-1",
+		"level": 3.0,
+		"roles": []interface{}{"reader", "writer"},
+		"act":   map[string]interface{}{"sub": "gateway"},
+	}
+	float := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name      string
+		assertion api.ClaimAssertion
+		passed    bool
+		malformed bool
+	}{
+		{name: "required", assertion: api.ClaimAssertion{Claim: "sub", Required: true}, passed: true},
+		{name: "required missing", assertion: api.ClaimAssertion{Claim: "email", Required: true}},
+		{name: "optional missing", assertion: api.ClaimAssertion{Claim: "email"}, passed: true},
+		{name: "equals", assertion: api.ClaimAssertion{Claim: "sub", Equals: "user-1"}, passed: true},
+		{name: "not equals", assertion: api.ClaimAssertion{Claim: "sub", Equals: "user-2"}},
+		{name: "equals missing", assertion: api.ClaimAssertion{Claim: "email", Equals: "user@example.com"}},
+		{name: "nested", assertion: api.ClaimAssertion{Claim: "act.sub", Equals: "gateway"}, passed: true},
+		{name: "nested missing", assertion: api.ClaimAssertion{Claim: "act.act.sub", Equals: "gateway"}},
+		{name: "in", assertion: api.ClaimAssertion{Claim: "sub", In: []interface{}{"user-1", "user-2"}}, passed: true},
+		{name: "array in", assertion: api.ClaimAssertion{Claim: "roles", In: []interface{}{"reader", "writer", "admin"}}, passed: true},
+		{name: "array not in", assertion: api.ClaimAssertion{Claim: "roles", In: []interface{}{"reader"}}},
+		{name: "in missing", assertion: api.ClaimAssertion{Claim: "tenant", In: []interface{}{"a"}}},
+		{name: "matches", assertion: api.ClaimAssertion{Claim: "sub", Matches: "^user-[0-9]+$"}, passed: true},
+		{name: "not matches", assertion: api.ClaimAssertion{Claim: "sub", Matches: "^admin-"}},
+		{name: "matches not string", assertion: api.ClaimAssertion{Claim: "level", Matches: "3"}},
+		{name: "matches missing", assertion: api.ClaimAssertion{Claim: "email", Matches: "@example.com$"}},
+		{name: "range", assertion: api.ClaimAssertion{Claim: "level", Min: float(1), Max: float(3)}, passed: true},
+		{name: "below min", assertion: api.ClaimAssertion{Claim: "level", Min: float(4)}},
+		{name: "above max", assertion: api.ClaimAssertion{Claim: "level", Max: float(2)}},
+		{name: "range not number", assertion: api.ClaimAssertion{Claim: "sub", Min: float(0)}},
+		{name: "min missing", assertion: api.ClaimAssertion{Claim: "age", Min: float(18)}},
+		{name: "max missing", assertion: api.ClaimAssertion{Claim: "age", Max: float(65)}},
+		{name: "without claim", assertion: api.ClaimAssertion{Required: true}, malformed: true},
+		{name: "invalid pattern", assertion: api.ClaimAssertion{Claim: "sub", Matches: "("}, malformed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passed, err := checkAssertion(claims, &test.assertion)
+			if malformed := err != nil; malformed != test.malformed {
+				t.Fatalf("malformed = %v, expected %v: %v", malformed, test.malformed, err)
+			}
+			if passed != test.passed {
+				t.Errorf("passed = %v, expected %v", passed, test.passed)
+			}
+		})
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	assertions := []api.ClaimAssertion{
+		{Claim: "sub", Required: true},
+		{Claim: "tenant", Equals: "acme"},
+	}
+
+	failed, err := checkAssertions(map[string]interface{}{"sub": "user"}, assertions)
+	if err != nil || failed == nil || failed.Claim != "tenant" {
+		t.Errorf("failed %v, %v, expected the tenant assertion", failed, err)
+	}
+
+	failed, err = checkAssertions(map[string]interface{}{"sub": "user", "tenant": "acme"}, assertions)
+	if err != nil || failed != nil {
+		t.Errorf("failed %v, %v, expected none", failed, err)
+	}
+}
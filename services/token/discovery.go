@@ -0,0 +1,104 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/fcoders/jwt-service/services"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// claims that can be found in the tokens issued by the service
+var supportedClaims = []string{"iss", "sub", "aud", "exp", "iat", "jti", "scope", "client_id", "act", authentication.ConfirmationClaim}
+
+// Discovery returns the OpenID Connect discovery document, with the endpoints
+// relative to the configured issuer URL. The document is not served when the
+// issuer is not set.
+func Discovery() *api.Response {
+
+	issuer := strings.TrimSuffix(settings.Get().JWT.Issuer, "/")
+	if issuer == "" {
+		return &api.Response{Status: http.StatusNotFound, ErrorCode: api.ErrorNotFound}
+	}
+
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+	if errJWT != nil {
+		services.Get().Logger.Infof("Error initializing backend: %s", errJWT)
+		return &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorRedis}
+	}
+
+	document := api.Discovery{
+		Issuer:                 issuer,
+		JWKSURI:                issuer + "/.well-known/jwks.json",
+		TokenEndpoint:          issuer + "/oauth/token",
+		IntrospectionEndpoint:  issuer + "/v1/token/introspect",
+		RevocationEndpoint:     issuer + "/oauth/revoke",
+		ResponseTypesSupported: []string{"token"},
+		GrantTypesSupported:    []string{GrantClientCredentials, GrantTokenExchange},
+		SubjectTypesSupported:  []string{"public"},
+		// the service issues no ID tokens, the algorithm advertised is the
+		// one signing the access tokens
+		IDTokenSigningAlgValuesSupported: []string{authentication.SigningAlgorithm.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{
+			clients.AuthMethodSecretBasic, clients.AuthMethodSecretPost, clients.AuthMethodPrivateKeyJWT,
+		},
+		ScopesSupported:                 supportedScopes(authBackend),
+		ClaimsSupported:                 supportedClaims,
+		DPoPSigningAlgValuesSupported:   []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"},
+		TLSClientCertificateBoundTokens: settings.Get().TLS.Enabled,
+	}
+
+	httpResponse := &api.Response{Status: http.StatusOK}
+	httpResponse.Payload, _ = ffjson.Marshal(document)
+	return httpResponse
+}
+
+// JWKS returns the public keys verifying the tokens issued by the service
+func JWKS() *api.Response {
+
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+	if errJWT != nil {
+		services.Get().Logger.Infof("Error initializing backend: %s", errJWT)
+		return &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorRedis}
+	}
+
+	httpResponse := &api.Response{Status: http.StatusOK}
+	httpResponse.Payload, _ = ffjson.Marshal(authBackend.JWKS())
+	return httpResponse
+}
+
+// supportedScopes returns the scopes registered for the clients with keys
+func supportedScopes(authBackend *authentication.JWTAuthenticationBackendKeys) []string {
+	unique := make(map[string]bool)
+	for client := range authBackend.Store {
+		for _, scope := range settings.GetClient(client).Scopes {
+			unique[scope] = true
+		}
+	}
+
+	scopes := make([]string, 0, len(unique))
+	for scope := range unique {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/audit"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/core/webhooks"
+)
+
+// notify sends a lifecycle event of the token to the webhooks. The event is
+// flagged when the claims come from a token not verified.
+func notify(eventType string, client string, claims jwt.MapClaims, unverified bool, reason string) {
+	event := api.LifecycleEvent{Type: eventType, Client: client, Reason: reason, Unverified: unverified}
+	event.Subject, _ = claims["sub"].(string)
+	event.JTI, _ = claims["jti"].(string)
+	webhooks.Notify(event)
+}
+
+// unverifiedClaims returns the claims of a token without verifying it, to
+// identify the tokens failing validation in their events. Claims are nil when
+// the token cannot be parsed.
+func unverifiedClaims(rawToken string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(rawToken, claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// audited appends the destruction or revocation of the token to the audit trail
+func audited(ctx context.Context, event string, client string, token *jwt.Token) {
+	claims := token.Claims.(jwt.MapClaims)
+	record := audit.Record{Event: event, Client: client, TokenSHA256: audit.TokenHash(token.Raw)}
+	record.Subject, _ = claims["sub"].(string)
+	record.JTI, _ = claims["jti"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		record.ExpiresAt = int64(exp)
+	}
+	audit.Log(ctx, record)
+}
+
+// outcome returns the outcome of the request in the metrics
+func outcome(httpResponse *api.Response) string {
+	if httpResponse.Status < http.StatusBadRequest {
+		return metrics.OutcomeSuccess
+	}
+	if code := errorCode(httpResponse); code != "" {
+		return code
+	}
+	return strconv.Itoa(httpResponse.Status)
+}
+
+// errorCode returns the error code of a failed response
+func errorCode(httpResponse *api.Response) string {
+	if httpResponse.ErrorCode != "" {
+		return httpResponse.ErrorCode
+	}
+
+	var errData api.ErrorData
+	json.Unmarshal(httpResponse.Payload, &errData)
+	return errData.Error
+}
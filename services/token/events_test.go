@@ -0,0 +1,50 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestUnverifiedClaims(t *testing.T) {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user", "jti": "id"}).SignedString([]byte("other key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		sub   string
+		jti   string
+	}{
+		{"unverified signature", signed, "user", "id"},
+		{"not a jwt", "token", "", ""},
+		{"empty", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := unverifiedClaims(test.token)
+			sub, _ := claims["sub"].(string)
+			jti, _ := claims["jti"].(string)
+			if sub != test.sub || jti != test.jti {
+				t.Errorf("sub %q, jti %q, expected %q, %q", sub, jti, test.sub, test.jti)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/services"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// Token types of RFC 8693
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// claims of the subject token that are not carried to the exchanged token
+var exchangeDroppedClaims = map[string]bool{
+	"iss": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true,
+	"scope": true, "client_id": true, "act": true, authentication.ConfirmationClaim: true,
+}
+
+// ExchangeToken issues a token for the audience client on behalf of the subject
+// of a token valid for the authenticated client, following the RFC 8693 token
+// exchange grant. The new token has an act claim chaining the actors.
+func ExchangeToken(ctx context.Context, request *api.TokenGrant, client string, confirmation *api.Confirmation, dpop *api.DPoPProof) (httpResponse *api.Response) {
+
+	defer func() {
+		metrics.TokensIssued.WithLabelValues(authentication.ClientLabel(client), "token_exchange", outcome(httpResponse)).Inc()
+	}()
+
+	httpResponse = new(api.Response)
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+
+	if errJWT != nil {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidClient
+		return httpResponse
+	}
+
+	if request.SubjectToken == "" || !isExchangeTokenType(request.SubjectTokenType) ||
+		(request.ActorToken != "" && !isExchangeTokenType(request.ActorTokenType)) ||
+		(request.RequestedTokenType != "" && !isExchangeTokenType(request.RequestedTokenType)) {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidRequest
+		return httpResponse
+	}
+
+	// tokens are issued for the client itself unless an audience is requested
+	audience := request.Audience
+	if audience == "" {
+		audience = client
+	}
+
+	if _, exists := authBackend.GetStore(audience); !exists || !canExchangeFor(client, audience) {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidTarget
+		return httpResponse
+	}
+
+	// a subject token bound to a key can only be exchanged along with it
+	confirmation, errResponse := dpopConfirmation(ctx, authBackend, confirmation, dpop)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	subjectClaims, _, denials, errResponse := verifyToken(ctx, authBackend, request.SubjectToken, client)
+	if errResponse != nil {
+		return errResponse
+	} else if len(denials) > 0 {
+		return policyDeniedResponse(denials)
+	}
+	if subjectClaims == nil || !authentication.VerifyConfirmation(subjectClaims, confirmation) {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidGrant
+		return httpResponse
+	}
+
+	// the actor is the subject of the actor token, or the client itself
+	actor := map[string]interface{}{"sub": client}
+	if request.ActorToken != "" {
+		actorClaims, _, denials, errResponse := verifyToken(ctx, authBackend, request.ActorToken, client)
+		if errResponse != nil {
+			return errResponse
+		} else if len(denials) > 0 {
+			return policyDeniedResponse(denials)
+		}
+		if actorClaims == nil || actorClaims["sub"] == nil {
+			httpResponse.Status = http.StatusBadRequest
+			httpResponse.ErrorCode = api.ErrorInvalidGrant
+			return httpResponse
+		}
+		actor["sub"] = actorClaims["sub"]
+	}
+
+	// scopes can only be narrowed, within the ones registered for the audience
+	scope, allowed := narrowedScope(request.Scope, availableScopes(subjectClaims, settings.GetClient(audience).Scopes))
+	if !allowed {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidScope
+		return httpResponse
+	}
+
+	claims := make(map[string]interface{}, len(subjectClaims))
+	for k, v := range subjectClaims {
+		if !exchangeDroppedClaims[k] {
+			claims[k] = v
+		}
+	}
+
+	if previous, ok := subjectClaims["act"].(map[string]interface{}); ok {
+		actor["act"] = previous
+	}
+	claims["act"] = actor
+	claims["aud"] = audience
+	claims["client_id"] = client
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	claims["exp"] = exchangeExpiration(subjectClaims)
+
+	token, expiresIn, errResponse := issueToken(ctx, authBackend, authentication.BindToken(claims, confirmation), audience)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	httpResponse.Status = http.StatusOK
+	httpResponse.Payload, _ = ffjson.Marshal(api.OAuthToken{
+		AccessToken:     token,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenType(confirmation),
+		ExpiresIn:       expiresIn,
+		Scope:           scope,
+	})
+
+	return httpResponse
+}
+
+func isExchangeTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
+
+// canExchangeFor returns true if the client can get tokens for the audience
+func canExchangeFor(client string, audience string) bool {
+	if client == audience {
+		return true
+	}
+
+	allowed := settings.GetClient(client).ExchangeAudiences
+	for i := range allowed {
+		if allowed[i] == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// exchangeExpiration returns the expiration of the exchanged token, capped at
+// the one of the subject token so exchanges can't extend its lifetime
+func exchangeExpiration(subjectClaims jwt.MapClaims) int64 {
+	expiration := time.Now().Add(time.Minute * time.Duration(settings.Get().JWT.TokenExpiration)).Unix()
+	if exp, ok := subjectClaims["exp"].(float64); ok && int64(exp) < expiration {
+		expiration = int64(exp)
+	}
+	return expiration
+}
+
+// availableScopes returns the registered scopes also granted to the subject
+// token, all the scopes of the token when there are none registered. Tokens
+// without scope have none available.
+func availableScopes(subjectClaims jwt.MapClaims, registered []string) []string {
+	granted := scopesOf(subjectClaims["scope"])
+
+	var scopes []string
+	for i := range granted {
+		if (len(registered) == 0 || containsScope(registered, granted[i])) && !containsScope(scopes, granted[i]) {
+			scopes = append(scopes, granted[i])
+		}
+	}
+	return scopes
+}
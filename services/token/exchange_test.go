@@ -0,0 +1,103 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestExchangeScopes(t *testing.T) {
+	registered := []string{"read", "write", "admin"}
+
+	tests := []struct {
+		name      string
+		subject   jwt.MapClaims
+		requested string
+		scope     string
+		allowed   bool
+	}{
+		{name: "all granted", subject: jwt.MapClaims{"scope": "read write"}, scope: "read write", allowed: true},
+		{name: "narrowed", subject: jwt.MapClaims{"scope": "read write"}, requested: "read", scope: "read", allowed: true},
+		{name: "widened", subject: jwt.MapClaims{"scope": "read"}, requested: "read write"},
+		{name: "not registered", subject: jwt.MapClaims{"scope": "read delete"}, scope: "read", allowed: true},
+		{name: "not registered requested", subject: jwt.MapClaims{"scope": "read delete"}, requested: "delete"},
+		{name: "array", subject: jwt.MapClaims{"scope": []interface{}{"read", "write"}}, requested: "write", scope: "write", allowed: true},
+		{name: "array widened", subject: jwt.MapClaims{"scope": []interface{}{"read"}}, requested: "admin"},
+		{name: "without scope", subject: jwt.MapClaims{}, scope: "", allowed: true},
+		{name: "without scope requested", subject: jwt.MapClaims{}, requested: "read"},
+		{name: "unknown type", subject: jwt.MapClaims{"scope": 1.0}, requested: "read"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scope, allowed := narrowedScope(test.requested, availableScopes(test.subject, registered))
+			if allowed != test.allowed || scope != test.scope {
+				t.Errorf("got %q, %v, expected %q, %v", scope, allowed, test.scope, test.allowed)
+			}
+		})
+	}
+}
+
+func TestAvailableScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		subject    jwt.MapClaims
+		registered []string
+		expected   []string
+	}{
+		{"registered", jwt.MapClaims{"scope": "read read write admin"}, []string{"read", "write"}, []string{"read", "write"}},
+		{"none registered", jwt.MapClaims{"scope": "read read write"}, nil, []string{"read", "write"}},
+		{"without scope", jwt.MapClaims{}, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if scopes := availableScopes(test.subject, test.registered); !reflect.DeepEqual(scopes, test.expected) {
+				t.Errorf("got %v, expected %v", scopes, test.expected)
+			}
+		})
+	}
+}
+
+func TestExchangeExpiration(t *testing.T) {
+	settings.LoadForTest(t, "jwt:\n  token_expiration: 60\n")
+
+	now := time.Now()
+	maxExpiration := now.Add(time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		subject  jwt.MapClaims
+		expected int64
+	}{
+		{"subject expires first", jwt.MapClaims{"exp": float64(now.Add(time.Minute).Unix())}, now.Add(time.Minute).Unix()},
+		{"subject expires later", jwt.MapClaims{"exp": float64(now.Add(2 * time.Hour).Unix())}, maxExpiration},
+		{"subject without exp", jwt.MapClaims{}, maxExpiration},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// allow the clock to tick while the test runs
+			if exp := exchangeExpiration(test.subject); exp < test.expected || exp > test.expected+1 {
+				t.Errorf("exp = %d, expected %d", exp, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/clients"
+	"github.com/fcoders/jwt-service/services"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// Introspect returns the state of the token following RFC 7662. Tokens that are
+// unknown, expired, revoked or issued to another client are reported as not active.
+func Introspect(ctx context.Context, request *api.TokenHint, client string) *api.Response {
+
+	httpResponse := new(api.Response)
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+
+	if errJWT != nil {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidClient
+		return httpResponse
+	}
+
+	// tokens denied by the validate policies of the client are not active
+	tokenClaims, _, _, errResponse := verifyToken(ctx, authBackend, request.Token, client)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	introspection := map[string]interface{}{"active": false}
+
+	if tokenClaims != nil && issuedTo(tokenClaims, client) {
+		for k, v := range tokenClaims {
+			introspection[k] = v
+		}
+
+		introspection["active"] = true
+		introspection["token_type"] = introspectedTokenType(tokenClaims)
+		if _, exists := introspection["client_id"]; !exists {
+			introspection["client_id"] = client
+		}
+	}
+
+	httpResponse.Payload, _ = ffjson.Marshal(introspection)
+	httpResponse.Status = http.StatusOK
+
+	return httpResponse
+}
+
+// issuedTo returns true if the token was issued to the client, or to another
+// client with the client as audience. Tokens without client_id were issued to
+// the client whose key verified them.
+func issuedTo(claims jwt.MapClaims, client string) bool {
+	clientID, exists := claims["client_id"]
+	if !exists {
+		return true
+	}
+
+	return clientID == client || clients.HasAudience(claims, client)
+}
+
+// introspectedTokenType returns the type of a verified token, DPoP when it is
+// bound to a DPoP key (RFC 9449 section 5)
+func introspectedTokenType(claims jwt.MapClaims) string {
+	cnf, _ := claims[authentication.ConfirmationClaim].(map[string]interface{})
+	jkt, _ := cnf[authentication.ConfirmationJKT].(string)
+	return tokenType(&api.Confirmation{KeyThumbprint: jkt})
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestIssuedTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected bool
+	}{
+		{"generated", jwt.MapClaims{"sub": "user"}, true},
+		{"own client", jwt.MapClaims{"client_id": "test"}, true},
+		{"other client", jwt.MapClaims{"client_id": "other"}, false},
+		{"audience", jwt.MapClaims{"client_id": "other", "aud": "test"}, true},
+		{"audience list", jwt.MapClaims{"client_id": "other", "aud": []interface{}{"orders", "test"}}, true},
+		{"other audience", jwt.MapClaims{"client_id": "other", "aud": "orders"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if issued := issuedTo(test.claims, "test"); issued != test.expected {
+				t.Errorf("issuedTo = %v, expected %v", issued, test.expected)
+			}
+		})
+	}
+}
+
+func TestIntrospectedTokenType(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected string
+	}{
+		{"not bound", jwt.MapClaims{"sub": "user"}, "Bearer"},
+		{"certificate", jwt.MapClaims{"cnf": map[string]interface{}{"x5t#S256": "thumbprint"}}, "Bearer"},
+		{"DPoP key", jwt.MapClaims{"cnf": map[string]interface{}{"jkt": "thumbprint"}}, "DPoP"},
+		{"certificate and DPoP key", jwt.MapClaims{"cnf": map[string]interface{}{"x5t#S256": "thumbprint", "jkt": "thumbprint"}}, "DPoP"},
+		{"unexpected cnf", jwt.MapClaims{"cnf": "jkt"}, "Bearer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if tokenType := introspectedTokenType(test.claims); tokenType != test.expected {
+				t.Errorf("token type %s, expected %s", tokenType, test.expected)
+			}
+		})
+	}
+}
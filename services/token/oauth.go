@@ -0,0 +1,138 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/services"
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+// Grant types supported by the token endpoint
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// IssueClientCredentials issues a token for the authenticated client itself,
+// following the RFC 6749 client credentials grant
+func IssueClientCredentials(ctx context.Context, request *api.TokenGrant, client string, confirmation *api.Confirmation, dpop *api.DPoPProof) (httpResponse *api.Response) {
+
+	defer func() {
+		metrics.TokensIssued.WithLabelValues(authentication.ClientLabel(client), GrantClientCredentials, outcome(httpResponse)).Inc()
+	}()
+
+	httpResponse = new(api.Response)
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+
+	if errJWT != nil {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidClient
+		return httpResponse
+	}
+
+	// the client needs its own keys to sign the token
+	if _, exists := authBackend.GetStore(client); !exists {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorUnauthorizedClient
+		return httpResponse
+	}
+
+	confirmation, errResponse := dpopConfirmation(ctx, authBackend, confirmation, dpop)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	scope, allowed := grantedScope(request.Scope, settings.GetClient(client).Scopes)
+	if !allowed {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidScope
+		return httpResponse
+	}
+
+	claims := map[string]interface{}{
+		"sub":       client,
+		"client_id": client,
+	}
+
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	token, expiresIn, errResponse := issueToken(ctx, authBackend, authentication.BindToken(claims, confirmation), client)
+	if errResponse != nil {
+		return errResponse
+	}
+
+	httpResponse.Status = http.StatusOK
+	httpResponse.Payload, _ = ffjson.Marshal(api.OAuthToken{
+		AccessToken: token,
+		TokenType:   tokenType(confirmation),
+		ExpiresIn:   expiresIn,
+		Scope:       scope,
+	})
+
+	return httpResponse
+}
+
+// tokenType returns the RFC 6749 token type, DPoP for tokens bound to a DPoP key
+func tokenType(confirmation *api.Confirmation) string {
+	if confirmation != nil && confirmation.KeyThumbprint != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// grantedScope returns the space-delimited scope granted for the request. When
+// no scope is requested, all the scopes registered for the client are granted.
+// Clients without registered scopes are not restricted, as in allowedScopes.
+func grantedScope(requested string, registered []string) (scope string, allowed bool) {
+	if len(registered) == 0 {
+		return strings.Join(strings.Fields(requested), " "), true
+	}
+	return narrowedScope(requested, registered)
+}
+
+// narrowedScope returns the space-delimited scope requested when all of its
+// scopes are available, or all the available scopes when none is requested
+func narrowedScope(requested string, available []string) (scope string, allowed bool) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(available, " "), true
+	}
+
+	scopes := strings.Fields(requested)
+	for i := range scopes {
+		found := false
+		for k := range available {
+			if scopes[i] == available[k] {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return "", false
+		}
+	}
+
+	return strings.Join(scopes, " "), true
+}
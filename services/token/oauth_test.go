@@ -0,0 +1,44 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"testing"
+)
+
+func TestGrantedScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  string
+		registered []string
+		scope      string
+		allowed    bool
+	}{
+		{"registered scopes", "read", []string{"read", "write"}, "read", true},
+		{"all registered scopes", "", []string{"read", "write"}, "read write", true},
+		{"scope not registered", "read admin", []string{"read", "write"}, "", false},
+		{"without registered scopes", "read  admin", nil, "read admin", true},
+		{"nothing requested or registered", " ", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scope, allowed := grantedScope(test.requested, test.registered)
+			if scope != test.scope || allowed != test.allowed {
+				t.Errorf("got %q, %v, expected %q, %v", scope, allowed, test.scope, test.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/audit"
+	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/core/webhooks"
+	"github.com/fcoders/jwt-service/services"
+)
+
+// Revoke invalidates the token following RFC 7009. Invalid, expired or already
+// revoked tokens, and tokens issued to other clients, are not an error, so the
+// response is always 200 unless the client is unknown or the blacklist cannot
+// be updated.
+func Revoke(ctx context.Context, request *api.TokenHint, client string) (httpResponse *api.Response) {
+
+	defer func() {
+		metrics.TokensDestroyed.WithLabelValues(authentication.ClientLabel(client), "revoke", outcome(httpResponse)).Inc()
+	}()
+
+	httpResponse = new(api.Response)
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+
+	if errJWT != nil {
+		httpResponse.Status = http.StatusUnauthorized
+		httpResponse.ErrorCode = api.ErrorInvalidClient
+		return httpResponse
+	}
+
+	if _, exists := authBackend.GetStore(client); !exists {
+		httpResponse.Status = http.StatusUnauthorized
+		httpResponse.ErrorCode = api.ErrorInvalidClient
+		return httpResponse
+	}
+
+	httpResponse.Status = http.StatusOK
+
+	// tokens issued to other clients are left untouched
+	token, errParse := authBackend.ParseToken(request.Token, client)
+	if errParse != nil || !token.Valid || !issuedTo(token.Claims.(jwt.MapClaims), client) {
+		return httpResponse
+	}
+
+	if err := authBackend.Destroy(ctx, token, client); err != nil {
+		services.Get().Logger.Infof("Error revoking token: %s", err)
+
+		// RFC 7009 asks the client to retry later
+		httpResponse.Status = http.StatusServiceUnavailable
+		httpResponse.ErrorCode = api.ErrorRedis
+	} else {
+		notify(webhooks.EventRevoked, client, token.Claims.(jwt.MapClaims), false, "")
+		audited(ctx, audit.EventRevoked, client, token)
+	}
+
+	return httpResponse
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"strings"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// scopesOf returns the scopes in a scope claim, as a space-delimited string or
+// an array
+func scopesOf(claim interface{}) []string {
+	switch scope := claim.(type) {
+	case string:
+		return strings.Fields(scope)
+	case []interface{}:
+		scopes := make([]string, 0, len(scope))
+		for i := range scope {
+			if s, ok := scope[i].(string); ok {
+				scopes = append(scopes, strings.Fields(s)...)
+			}
+		}
+		return scopes
+	case []string:
+		return scope
+	}
+	return nil
+}
+
+// allowedScopes checks the scope claim of a token request against the scopes
+// declared for the client. Depending on the client's scope policy, scopes out
+// of the allowance are removed or the request is rejected. Clients without
+// declared scopes are not restricted.
+func allowedScopes(claims map[string]interface{}, client string) (allowed bool) {
+	claim, exists := claims["scope"]
+	if !exists {
+		return true
+	}
+
+	clientSettings := settings.GetClient(client)
+	requested := scopesOf(claim)
+	if len(clientSettings.Scopes) == 0 {
+		claims["scope"] = strings.Join(requested, " ")
+		return true
+	}
+
+	granted := make([]string, 0, len(requested))
+	for i := range requested {
+		if containsScope(clientSettings.Scopes, requested[i]) {
+			granted = append(granted, requested[i])
+		} else if clientSettings.ScopePolicy != settings.ScopePolicyTrim {
+			return false
+		}
+	}
+
+	if len(granted) == 0 {
+		delete(claims, "scope")
+	} else {
+		claims["scope"] = strings.Join(granted, " ")
+	}
+	return true
+}
+
+// hasScopes returns true if the scope claim includes all the required scopes
+func hasScopes(claim interface{}, required []string) bool {
+	scopes := scopesOf(claim)
+	for i := range required {
+		if !containsScope(scopes, required[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for i := range scopes {
+		if scopes[i] == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestAllowedScopes(t *testing.T) {
+	settings.LoadForTest(t, `
+clients:
+  rejecting:
+    scopes: [read, write]
+  trimming:
+    scopes: [read, write]
+    scope_policy: trim
+`)
+
+	tests := []struct {
+		name     string
+		client   string
+		claims   map[string]interface{}
+		allowed  bool
+		expected map[string]interface{}
+	}{
+		{"without scope", "rejecting", map[string]interface{}{}, true, map[string]interface{}{}},
+		{"allowed", "rejecting", map[string]interface{}{"scope": "read write"}, true, map[string]interface{}{"scope": "read write"}},
+		{"allowed array", "rejecting", map[string]interface{}{"scope": []interface{}{"read", "write"}}, true, map[string]interface{}{"scope": "read write"}},
+		{"rejected", "rejecting", map[string]interface{}{"scope": "read admin"}, false, nil},
+		{"trimmed", "trimming", map[string]interface{}{"scope": "read admin"}, true, map[string]interface{}{"scope": "read"}},
+		{"trimmed to none", "trimming", map[string]interface{}{"scope": "admin"}, true, map[string]interface{}{}},
+		{"not restricted", "other", map[string]interface{}{"scope": []interface{}{"admin"}}, true, map[string]interface{}{"scope": "admin"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed := allowedScopes(test.claims, test.client)
+			if allowed != test.allowed {
+				t.Fatalf("allowed = %v, expected %v", allowed, test.allowed)
+			}
+			if allowed && !reflect.DeepEqual(test.claims, test.expected) {
+				t.Errorf("claims %v, expected %v", test.claims, test.expected)
+			}
+		})
+	}
+}
+
+func TestHasScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		claim    interface{}
+		required []string
+		expected bool
+	}{
+		{"string", "read write", []string{"write"}, true},
+		{"array", []interface{}{"read", "write"}, []string{"read", "write"}, true},
+		{"missing scope", "read", []string{"read", "write"}, false},
+		{"without claim", nil, []string{"read"}, false},
+		{"nothing required", nil, nil, true},
+		{"not a scope", 1.0, []string{"read"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if has := hasScopes(test.claim, test.required); has != test.expected {
+				t.Errorf("hasScopes = %v, expected %v", has, test.expected)
+			}
+		})
+	}
+}
@@ -15,19 +15,32 @@
 package token
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/fcoders/jwt-service/api"
+	"github.com/fcoders/jwt-service/core/audit"
 	"github.com/fcoders/jwt-service/core/authentication"
+	"github.com/fcoders/jwt-service/core/cache"
+	"github.com/fcoders/jwt-service/core/metrics"
+	"github.com/fcoders/jwt-service/core/policy"
+	"github.com/fcoders/jwt-service/core/webhooks"
 	"github.com/fcoders/jwt-service/services"
+	"github.com/fcoders/jwt-service/settings"
 	"github.com/pquerna/ffjson/ffjson"
 )
 
-// Generate generates a new token
-func Generate(request *api.Claim, client string) *api.Response {
+// Generate generates a new token. When a confirmation or a DPoP proof is given,
+// the token is bound to the proof-of-possession key.
+func Generate(ctx context.Context, request *api.Claim, client string, confirmation *api.Confirmation, dpop *api.DPoPProof) (httpResponse *api.Response) {
 
-	httpResponse := new(api.Response)
+	defer func() {
+		metrics.TokensIssued.WithLabelValues(authentication.ClientLabel(client), "generate", outcome(httpResponse)).Inc()
+	}()
+
+	httpResponse = new(api.Response)
 	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
 
 	if errJWT != nil {
@@ -36,16 +49,23 @@ func Generate(request *api.Claim, client string) *api.Response {
 		return httpResponse
 	}
 
-	token, expiresIn, err := authBackend.GenerateToken(request.Claims, client)
-	if err != nil {
-
-		services.Get().Logger.Infof("Error generating token: %s", err)
+	confirmation, errResponse := dpopConfirmation(ctx, authBackend, confirmation, dpop)
+	if errResponse != nil {
+		return errResponse
+	}
 
-		httpResponse.Status = http.StatusInternalServerError
-		httpResponse.ErrorCode = api.ErrorCreatingToken
+	claims := authentication.BindToken(request.Claims, confirmation)
+	if !allowedScopes(claims, client) {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidScope
 		return httpResponse
 	}
 
+	token, expiresIn, errResponse := issueToken(ctx, authBackend, claims, client)
+	if errResponse != nil {
+		return errResponse
+	}
+
 	httpResponse.Status = http.StatusOK
 	httpResponse.Payload, _ = ffjson.Marshal(api.Token{Token: token, ExpiresIn: expiresIn})
 
@@ -53,9 +73,26 @@ func Generate(request *api.Claim, client string) *api.Response {
 }
 
 // Validate validates the token
-func Validate(request *api.Token, client string) *api.Response {
+func Validate(ctx context.Context, request *api.Token, client string) (httpResponse *api.Response) {
+
+	var tokenClaims jwt.MapClaims
+	start := time.Now()
+	defer func() {
+		clientLabel := authentication.ClientLabel(client)
+		metrics.ValidationDuration.WithLabelValues(clientLabel).Observe(time.Since(start).Seconds())
+		metrics.TokensValidated.WithLabelValues(clientLabel, outcome(httpResponse)).Inc()
+
+		if httpResponse.Status != http.StatusOK {
+			unverified := false
+			if tokenClaims == nil {
+				tokenClaims = unverifiedClaims(request.Token)
+				unverified = tokenClaims != nil
+			}
+			notify(webhooks.EventValidationFailed, client, tokenClaims, unverified, errorCode(httpResponse))
+		}
+	}()
 
-	httpResponse := new(api.Response)
+	httpResponse = new(api.Response)
 	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
 
 	if errJWT != nil {
@@ -64,54 +101,209 @@ func Validate(request *api.Token, client string) *api.Response {
 		return httpResponse
 	}
 
-	// check if token is not in blacklist
-	if authBackend.IsInBlacklist(request.Token) {
+	// proofs are verified for the method and URL of the request they came with
+	if request.DPoP != "" && (request.HTM == "" || request.HTU == "") {
 		httpResponse.Status = http.StatusBadRequest
-		httpResponse.ErrorCode = api.ErrorInvalidToken
-
-	} else {
+		httpResponse.ErrorCode = api.ErrorInvalidRequest
+		return httpResponse
+	}
 
-		// parse token and check its validity
-		token, err := authBackend.ParseToken(request.Token, client)
-		tokenClaims := token.Claims.(jwt.MapClaims)
+	tokenClaims, blacklistCheck, denials, errResponse := verifyToken(ctx, authBackend, request.Token, client)
+	if errResponse != nil {
+		return errResponse
+	} else if len(denials) > 0 {
+		return policyDeniedResponse(denials)
+	}
 
-		if err == nil && token.Valid {
-			// return claims data
+	if tokenClaims == nil {
+		// token is not valid
+		response, _ := ffjson.Marshal(api.ErrorData{Error: api.ErrorInvalidToken, Message: api.ErrorMessages[api.ErrorInvalidToken]})
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.Payload = response
+		return httpResponse
+	}
 
-			claims := make(map[string]interface{})
-			for k, v := range tokenClaims {
-				switch k {
+	// bound tokens are only valid along with their key
+	presented := &api.Confirmation{CertificateThumbprint: request.CertificateThumbprint}
+	if request.DPoP != "" {
+		jkt, errDPoP := authBackend.VerifyDPoPProof(ctx, request.DPoP, request.HTM, request.HTU, request.Token)
+		if errDPoP != nil {
+			return dpopErrorResponse(errDPoP)
+		}
+		presented.KeyThumbprint = jkt
+	}
 
-				case "exp":
-					expiresIn := authBackend.GetTokenRemainingValidity(tokenClaims["exp"])
-					claims["expires_in"] = expiresIn
+	if !authentication.VerifyConfirmation(tokenClaims, presented) {
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.ErrorCode = api.ErrorInvalidBinding
+		return httpResponse
+	}
 
-				default:
-					claims[k] = v
-				}
-			}
+	if !hasScopes(tokenClaims["scope"], request.RequiredScopes) {
+		httpResponse.Status = http.StatusForbidden
+		httpResponse.ErrorCode = api.ErrorInsufficientScope
+		return httpResponse
+	}
 
-			response, _ := ffjson.Marshal(api.Claim{Claims: claims})
-			httpResponse.Payload = response
-			httpResponse.Status = http.StatusOK
+	failed, errAssertion := checkAssertions(tokenClaims, request.Assertions)
+	if errAssertion != nil {
+		response, _ := ffjson.Marshal(api.ErrorData{Error: api.ErrorInvalidRequest, Message: errAssertion.Error()})
+		httpResponse.Status = http.StatusBadRequest
+		httpResponse.Payload = response
+		return httpResponse
+	} else if failed != nil {
+		response, _ := ffjson.Marshal(api.ErrorData{Error: api.ErrorFailedAssertion, Message: api.ErrorMessages[api.ErrorFailedAssertion], Assertion: failed})
+		httpResponse.Status = http.StatusForbidden
+		httpResponse.Payload = response
+		return httpResponse
+	}
 
-		} else {
+	// return claims data
+	claims := make(map[string]interface{})
+	for k, v := range tokenClaims {
+		switch k {
 
-			// token is not valid
-			response, _ := ffjson.Marshal(api.ErrorData{Error: api.ErrorInvalidToken, Message: api.ErrorMessages[api.ErrorInvalidToken]})
-			httpResponse.Status = http.StatusBadRequest
-			httpResponse.Payload = response
+		case "exp":
+			expiresIn := authBackend.GetTokenRemainingValidity(tokenClaims["exp"])
+			claims["expires_in"] = expiresIn
 
+		default:
+			claims[k] = v
 		}
 	}
 
+	response, _ := ffjson.Marshal(api.Claim{Claims: claims, BlacklistCheck: blacklistCheck})
+	httpResponse.Payload = response
+	httpResponse.Status = http.StatusOK
+
 	return httpResponse
 }
 
+// issueToken generates a token for the client, once the claims pass the
+// generate policies of the client. Every grant issues its tokens through here.
+func issueToken(ctx context.Context, authBackend *authentication.JWTAuthenticationBackendKeys, claims map[string]interface{}, client string) (token string, expiresIn int, errResponse *api.Response) {
+
+	if denials := policy.Evaluate(client, policy.Generate, claims); len(denials) > 0 {
+		errResponse = policyDeniedResponse(denials)
+		return
+	}
+
+	token, expiresIn, err := authBackend.GenerateToken(ctx, claims, client)
+	if err != nil {
+		services.Get().Logger.Infof("Error generating token: %s", err)
+		errResponse = &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorCreatingToken}
+	}
+
+	return
+}
+
+// policyDeniedResponse returns the response for a request denied by the client policies
+func policyDeniedResponse(denials []api.PolicyDenial) *api.Response {
+	response, _ := ffjson.Marshal(api.ErrorData{Error: api.ErrorPolicyDenied, Message: api.ErrorMessages[api.ErrorPolicyDenied], Denials: denials})
+	return &api.Response{Status: http.StatusForbidden, Payload: response}
+}
+
+// dpopConfirmation adds the key of the DPoP proof to the confirmation, when a
+// proof is given
+func dpopConfirmation(ctx context.Context, authBackend *authentication.JWTAuthenticationBackendKeys, confirmation *api.Confirmation, dpop *api.DPoPProof) (*api.Confirmation, *api.Response) {
+	if dpop == nil {
+		return confirmation, nil
+	}
+
+	jkt, err := authBackend.VerifyDPoPProof(ctx, dpop.Proof, dpop.Method, dpop.URL, "")
+	if err != nil {
+		return nil, dpopErrorResponse(err)
+	}
+
+	bound := new(api.Confirmation)
+	if confirmation != nil {
+		*bound = *confirmation
+	}
+	bound.KeyThumbprint = jkt
+
+	return bound, nil
+}
+
+// dpopErrorResponse returns the response for a proof that cannot be verified
+func dpopErrorResponse(err error) *api.Response {
+	switch err {
+	case authentication.ErrInvalidDPoPProof:
+		return &api.Response{Status: http.StatusBadRequest, ErrorCode: api.ErrorInvalidDPoPProof}
+	case cache.ErrTimeout:
+		return &api.Response{Status: http.StatusGatewayTimeout, ErrorCode: api.ErrorTimeout}
+	default:
+		return &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorRedis}
+	}
+}
+
+// verifyToken checks that the token is not in the blacklist, is valid for the
+// client and passes its validate policies. Claims are nil when the token is not
+// valid, along with the denials when policies reject it, and errResponse is only
+// set when the validity cannot be determined.
+func verifyToken(ctx context.Context, authBackend *authentication.JWTAuthenticationBackendKeys, rawToken string, client string) (claims jwt.MapClaims, blacklistCheck string, denials []api.PolicyDenial, errResponse *api.Response) {
+
+	// check if token is not in blacklist
+	blacklisted, blacklistCheck, errCache := checkBlacklist(ctx, authBackend, rawToken, client)
+	if errCache == cache.ErrTimeout {
+		errResponse = &api.Response{Status: http.StatusGatewayTimeout, ErrorCode: api.ErrorTimeout}
+		return
+	} else if errCache != nil {
+		errResponse = &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorRedis}
+		return
+	} else if blacklisted {
+		return
+	}
+
+	// parse token and check its validity
+	token, err := authBackend.ParseToken(rawToken, client)
+	if err != nil || !token.Valid {
+		return
+	}
+
+	tokenClaims := token.Claims.(jwt.MapClaims)
+	if denials = policy.Evaluate(client, policy.Validate, tokenClaims); len(denials) == 0 {
+		claims = tokenClaims
+	}
+
+	return
+}
+
+// checkBlacklist looks for the token in the blacklist. When the cache cannot be
+// reached, the failure policy configured for the client decides the result.
+func checkBlacklist(ctx context.Context, authBackend *authentication.JWTAuthenticationBackendKeys, token string, client string) (blacklisted bool, blacklistCheck string, err error) {
+
+	blacklisted, err = authBackend.IsInBlacklist(ctx, token)
+	if err == nil {
+		return
+	}
+
+	switch settings.GetClient(client).BlacklistFailure {
+
+	case settings.BlacklistFailOpen:
+		metrics.BlacklistFallbacks.WithLabelValues(authentication.ClientLabel(client), settings.BlacklistFailOpen).Inc()
+		services.Get().Logger.Infof("Blacklist not available, accepting token for client %s: %s", client, err)
+		return false, api.BlacklistCheckSkipped, nil
+
+	case settings.BlacklistFailLocal:
+		metrics.BlacklistFallbacks.WithLabelValues(authentication.ClientLabel(client), settings.BlacklistFailLocal).Inc()
+		services.Get().Logger.Infof("Blacklist not available, using local revocations for client %s: %s", client, err)
+		return authBackend.IsInLocalBlacklist(token), api.BlacklistCheckLocal, nil
+
+	default:
+		metrics.BlacklistFallbacks.WithLabelValues(authentication.ClientLabel(client), settings.BlacklistFailClosed).Inc()
+		services.Get().Logger.Infof("Blacklist not available, rejecting token for client %s: %s", client, err)
+		return
+	}
+}
+
 // Destroy executes the logout
-func Destroy(request *api.Token, client string) *api.Response {
+func Destroy(ctx context.Context, request *api.Token, client string) (httpResponse *api.Response) {
+
+	defer func() {
+		metrics.TokensDestroyed.WithLabelValues(authentication.ClientLabel(client), "destroy", outcome(httpResponse)).Inc()
+	}()
 
-	httpResponse := new(api.Response)
+	httpResponse = new(api.Response)
 	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
 
 	if errJWT != nil {
@@ -127,13 +319,41 @@ func Destroy(request *api.Token, client string) *api.Response {
 		return httpResponse
 	}
 
-	err := authBackend.Destroy(token)
-	if err != nil {
+	err := authBackend.Destroy(ctx, token, client)
+	if err == cache.ErrTimeout {
+		httpResponse.Status = http.StatusGatewayTimeout
+		httpResponse.ErrorCode = api.ErrorTimeout
+	} else if err != nil {
 		httpResponse.Status = http.StatusInternalServerError
 		httpResponse.ErrorCode = api.ErrorRedis
 	} else {
 		httpResponse.Status = http.StatusOK
+		notify(webhooks.EventDestroyed, client, token.Claims.(jwt.MapClaims), false, "")
+		audited(ctx, audit.EventDestroyed, client, token)
 	}
 
 	return httpResponse
 }
+
+// Revocations returns a channel receiving the revocations of the client's tokens
+func Revocations(client string) (events <-chan api.RevocationEvent, stop func(), httpResponse *api.Response) {
+
+	authBackend, errJWT := authentication.InitJWTAuthenticationBackend(services.Get().Cache)
+	if errJWT != nil {
+		httpResponse = &api.Response{Status: http.StatusBadRequest, ErrorCode: api.ErrorInvalidClient}
+		return
+	}
+
+	if _, exists := authBackend.GetStore(client); !exists {
+		httpResponse = &api.Response{Status: http.StatusBadRequest, ErrorCode: api.ErrorInvalidClient}
+		return
+	}
+
+	events, stop, err := authBackend.ListenRevocations(client)
+	if err != nil {
+		services.Get().Logger.Infof("Error listening revocations: %s", err)
+		httpResponse = &api.Response{Status: http.StatusInternalServerError, ErrorCode: api.ErrorRedis}
+	}
+
+	return
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/fcoders/jwt-service/core/policy"
+	"github.com/fcoders/jwt-service/settings"
+)
+
+func TestIssueTokenPolicies(t *testing.T) {
+	settings.LoadForTest(t, `
+clients:
+  test:
+    policies:
+      generate:
+        - name: role
+          rule: "has(claims.role)"
+`)
+	if err := policy.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// denied claims don't reach the backend
+	_, _, errResponse := issueToken(context.Background(), nil, map[string]interface{}{"sub": "user"}, "test")
+	if errResponse == nil || errResponse.Status != http.StatusForbidden {
+		t.Errorf("got %+v, expected a policy denial", errResponse)
+	}
+}
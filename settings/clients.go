@@ -0,0 +1,115 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+// Policies applied when the blacklist store cannot be reached
+const (
+	BlacklistFailClosed = "closed" // reject the token
+	BlacklistFailOpen   = "open"   // accept the token, flagging the response
+	BlacklistFailLocal  = "local"  // use the local mirror of recent revocations
+)
+
+// Policies applied to generate requests with scopes not declared for the client
+const (
+	ScopePolicyReject = "reject" // reject the request
+	ScopePolicyTrim   = "trim"   // remove the scopes from the token
+)
+
+// ClientSettings holds the options configured for a client ID in the
+// 'clients' section of settings.yml
+type ClientSettings struct {
+	BlacklistFailure string `yaml:"blacklist_failure"`
+
+	// wrap the tokens in a JWE, using keys/<client>/enc.key or enc.pub
+	EncryptTokens bool `yaml:"encrypt_tokens"`
+
+	// OAuth client registration
+	SecretHashes []string `yaml:"secret_hashes"` // bcrypt hashes of the client secrets
+	AssertionKey string   `yaml:"assertion_key"` // public key file for private_key_jwt
+	Scopes       []string `yaml:"scopes"`
+	ScopePolicy  string   `yaml:"scope_policy"`
+
+	// clients the client may exchange its tokens for (RFC 8693)
+	ExchangeAudiences []string `yaml:"exchange_audiences"`
+
+	// credentials of the callers allowed to generate and destroy tokens
+	APIKeyHashes []string `yaml:"api_key_hashes"` // hex SHA-256 of the API keys
+	HMACSecrets  []string `yaml:"hmac_secrets"`
+
+	// TLS client certificates identifying the client, by subject or common name
+	CertificateSubjects []string `yaml:"certificate_subjects"`
+
+	// external issuers whose tokens are accepted for the client
+	TrustedIssuers []TrustedIssuer `yaml:"trusted_issuers"`
+
+	// user directory the claims of the subjects are taken from
+	Enrichment Enrichment `yaml:"enrichment"`
+
+	// CEL expressions the claims must pass
+	Policies struct {
+		Generate []Policy `yaml:"generate"` // on the requested claims
+		Validate []Policy `yaml:"validate"` // on the claims of the token
+	} `yaml:"policies"`
+}
+
+// Enrichment describes the source of the claims added to the tokens of a
+// client, by subject
+type Enrichment struct {
+	Source   string   `yaml:"source"` // file, sqlite or http
+	Path     string   `yaml:"path"`   // JSON/YAML file or SQLite database
+	Query    string   `yaml:"query"`  // SQLite query, with the subject as parameter
+	URL      string   `yaml:"url"`
+	Timeout  int      `yaml:"timeout"`  // milliseconds
+	Claims   []string `yaml:"claims"`   // claims taken from the source, all when empty
+	Required bool     `yaml:"required"` // fail when the source cannot be read
+}
+
+// Policy is a CEL expression evaluated with the variables 'claims' and
+// 'client', allowing the request when it returns true
+type Policy struct {
+	Name    string `yaml:"name"`
+	Rule    string `yaml:"rule"`
+	Message string `yaml:"message"` // returned when the policy denies the request
+}
+
+// TrustedIssuer describes an external identity provider, verified with the
+// keys published in its JWKS
+type TrustedIssuer struct {
+	Issuer   string `yaml:"issuer"`
+	JWKSURL  string `yaml:"jwks_uri"`
+	Audience string `yaml:"audience"`  // required aud value, if any
+	CacheTTL int    `yaml:"cache_ttl"` // seconds the keys are cached
+}
+
+// GetTrustedIssuer returns the trusted issuer configuration matching iss
+func (c *ClientSettings) GetTrustedIssuer(iss string) (*TrustedIssuer, bool) {
+	for i := range c.TrustedIssuers {
+		if iss != "" && c.TrustedIssuers[i].Issuer == iss {
+			return &c.TrustedIssuers[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetClient returns the settings for a client ID. Clients without an entry
+// in settings.yml get the default values.
+func GetClient(id string) *ClientSettings {
+	if cfg != nil {
+		if client, exists := cfg.Clients[id]; exists && client != nil {
+			return client
+		}
+	}
+	return new(ClientSettings)
+}
@@ -28,20 +28,100 @@ import (
 // Settings is the structure used to hold configuration from settings.yml
 type Settings struct {
 	App struct {
-		HTTPPort int `yaml:"http_port"`
-		LogLevel int `yaml:"log_level"`
+		HTTPPort          int  `yaml:"http_port"`
+		LogLevel          int  `yaml:"log_level"`
+		RequireCallerAuth bool `yaml:"require_caller_auth"`
 	} `yaml:"app"`
+	TLS struct {
+		Enabled        bool     `yaml:"enabled"`
+		Port           int      `yaml:"port"`
+		CertFile       string   `yaml:"cert_file"`
+		KeyFile        string   `yaml:"key_file"`
+		MinVersion     string   `yaml:"min_version"`
+		CipherSuites   []string `yaml:"cipher_suites"`
+		ClientAuth     string   `yaml:"client_auth"`
+		ClientCAFile   string   `yaml:"client_ca_file"`
+		ReloadInterval int      `yaml:"reload_interval"` // seconds
+	} `yaml:"tls"`
 	JWT struct {
-		TokenExpiration int `yaml:"token_expiration"`
+		TokenExpiration int    `yaml:"token_expiration"`
+		Issuer          string `yaml:"issuer"`
+		DPoPMaxAge      int    `yaml:"dpop_max_age"` // seconds
 	} `yaml:"jwt"`
 	Redis struct {
+		Mode     string `yaml:"mode"`
 		Address  string `yaml:"address"`
+		Username string `yaml:"username"`
 		Password string `yaml:"password"`
+		Database int    `yaml:"database"`
+		Sentinel struct {
+			MasterName string   `yaml:"master_name"`
+			Addresses  []string `yaml:"addresses"`
+		} `yaml:"sentinel"`
+		Cluster struct {
+			Addresses []string `yaml:"addresses"`
+		} `yaml:"cluster"`
+		TLS struct {
+			Enabled            bool   `yaml:"enabled"`
+			CAFile             string `yaml:"ca_file"`
+			CertFile           string `yaml:"cert_file"`
+			KeyFile            string `yaml:"key_file"`
+			ServerName         string `yaml:"server_name"`
+			InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+		} `yaml:"tls"`
+		Timeouts struct {
+			Dial      int `yaml:"dial"`
+			Read      int `yaml:"read"`
+			Write     int `yaml:"write"`
+			Operation int `yaml:"operation"`
+		} `yaml:"timeouts"` // milliseconds
+		Pool struct {
+			MaxIdle     int  `yaml:"max_idle"`
+			MaxActive   int  `yaml:"max_active"`
+			IdleTimeout int  `yaml:"idle_timeout"` // seconds
+			Wait        bool `yaml:"wait"`
+		} `yaml:"pool"`
 	} `yaml:"redis"`
+	Blacklist struct {
+		Filter struct {
+			Enabled           bool    `yaml:"enabled"`
+			Capacity          int     `yaml:"capacity"`
+			FalsePositiveRate float64 `yaml:"false_positive_rate"`
+			LRUSize           int     `yaml:"lru_size"`
+			ResyncInterval    int     `yaml:"resync_interval"` // seconds
+		} `yaml:"filter"`
+	} `yaml:"blacklist"`
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Address string `yaml:"address"` // own listener, not exposed with the API
+		Path    string `yaml:"path"`
+	} `yaml:"metrics"`
+	Audit struct {
+		Enabled   bool   `yaml:"enabled"`
+		Output    string `yaml:"output"` // file path or stdout
+		HashChain bool   `yaml:"hash_chain"`
+	} `yaml:"audit"`
+	Webhooks struct {
+		Enabled        bool              `yaml:"enabled"`
+		Endpoints      []WebhookEndpoint `yaml:"endpoints"`
+		Retries        int               `yaml:"retries"`
+		RetryInterval  int               `yaml:"retry_interval"` // milliseconds, doubled on each retry
+		Timeout        int               `yaml:"timeout"`        // milliseconds
+		QueueSize      int               `yaml:"queue_size"`     // events pending of each endpoint
+		DeadLetterFile string            `yaml:"dead_letter_file"`
+	} `yaml:"webhooks"`
 	Proxy struct {
 		Enabled bool   `yaml:"enabled"`
 		Address string `yaml:"address"`
 	} `yaml:"proxy"`
+	Clients map[string]*ClientSettings `yaml:"clients"`
+}
+
+// WebhookEndpoint is a receiver of the token lifecycle events
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // HMAC-SHA256 key of the signatures
+	Events []string `yaml:"events"` // all the events when empty
 }
 
 // Log destinations
@@ -87,6 +167,9 @@ func GetHTTPClient() (client *http.Client) {
 func loadSettingsFromFile(file string) error {
 	cfg = new(Settings)
 
+	// callers must be authenticated unless it's explicitly disabled
+	cfg.App.RequireCallerAuth = true
+
 	fileContent, errRead := ioutil.ReadFile(file)
 	if errRead != nil {
 		return errRead
@@ -0,0 +1,35 @@
+// Copyright 2018 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settings
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// LoadForTest initializes the settings with the yaml content, saved in a
+// temporary file of the test
+func LoadForTest(t testing.TB, content string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "settings.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(path); err != nil {
+		t.Fatal(err)
+	}
+}
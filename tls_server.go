@@ -0,0 +1,207 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+	"github.com/fcoders/logger"
+)
+
+// Client certificate policies for the HTTPS listener
+const (
+	clientAuthNone    = "none"
+	clientAuthRequest = "request" // verify the certificate if one is presented
+	clientAuthRequire = "require"
+)
+
+const (
+	defaultReloadInterval = time.Minute
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificateReloader holds the server certificate and client CA bundle,
+// loading them again when the files change
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+}
+
+// newTLSConfig builds the configuration for the HTTPS listener from settings
+func newTLSConfig() (*tls.Config, error) {
+	conf := settings.Get().TLS
+
+	reloader := &certificateReloader{certFile: conf.CertFile, keyFile: conf.KeyFile, caFile: conf.ClientCAFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(conf.ReloadInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	go reloader.watch(interval)
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if conf.MinVersion != "" {
+		version, exists := tlsVersions[conf.MinVersion]
+		if !exists {
+			return nil, fmt.Errorf("Unknown TLS version %s", conf.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(conf.CipherSuites) > 0 {
+		suites, err := cipherSuites(conf.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	switch conf.ClientAuth {
+	case "", clientAuthNone:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case clientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case clientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("Unknown client auth policy %s", conf.ClientAuth)
+	}
+
+	if tlsConfig.ClientAuth != tls.NoClientCert && conf.ClientCAFile == "" {
+		return nil, fmt.Errorf("A client CA file is required to verify client certificates")
+	}
+
+	// certificates are taken from the reloader on every handshake
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		reloader.mutex.RLock()
+		defer reloader.mutex.RUnlock()
+
+		config := tlsConfig.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*reloader.cert}
+		config.ClientCAs = reloader.clientCAs
+		return config, nil
+	}
+
+	return tlsConfig, nil
+}
+
+func cipherSuites(names []string) ([]uint16, error) {
+	available := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		available[suite.Name] = suite.ID
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for i := range names {
+		id, exists := available[names[i]]
+		if !exists {
+			return nil, fmt.Errorf("Unknown cipher suite %s", names[i])
+		}
+		suites = append(suites, id)
+	}
+
+	return suites, nil
+}
+
+// reload loads the certificate and the client CA bundle from their files
+func (r *certificateReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("Error loading TLS certificate: %s", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		caCerts, errRead := ioutil.ReadFile(r.caFile)
+		if errRead != nil {
+			return fmt.Errorf("Error reading client CA file: %s", errRead)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCerts) {
+			return fmt.Errorf("No certificates found in client CA file %s", r.caFile)
+		}
+	}
+
+	r.mutex.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = r.lastModification()
+	r.mutex.Unlock()
+
+	return nil
+}
+
+// lastModification returns the most recent modification time of the files
+func (r *certificateReloader) lastModification() (modTime time.Time) {
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return
+}
+
+// watch reloads the files when they change. On errors, the current
+// certificates are kept.
+func (r *certificateReloader) watch(interval time.Duration) {
+	log := logger.GetLogger()
+
+	for range time.Tick(interval) {
+		r.mutex.RLock()
+		changed := r.lastModification().After(r.modTime)
+		r.mutex.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.reload(); err != nil {
+			log.Infof("Error reloading TLS certificates: %s", err)
+		} else {
+			log.Infof("TLS certificates reloaded")
+		}
+	}
+}
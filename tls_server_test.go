@@ -0,0 +1,210 @@
+// Copyright 2019 Foo Coders (www.foocoders.io).
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fcoders/jwt-service/settings"
+)
+
+// writeCertificate writes a self-signed certificate with the serial number and
+// its key to the directory, returning the paths of the files
+func writeCertificate(t *testing.T, dir string, serial int64) (certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "jwt-service"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serial returns the serial number of the certificate
+func serial(t *testing.T, cert *tls.Certificate) int64 {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.SerialNumber.Int64()
+}
+
+func TestCipherSuites(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		expected []uint16
+		valid    bool
+	}{
+		{"secure", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+			[]uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}, true},
+		{"insecure", []string{"TLS_RSA_WITH_RC4_128_SHA"}, []uint16{tls.TLS_RSA_WITH_RC4_128_SHA}, true},
+		{"unknown", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "TLS_NULL"}, nil, false},
+		{"lowercase", []string{"tls_ecdhe_rsa_with_aes_256_gcm_sha384"}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suites, err := cipherSuites(test.names)
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("valid = %v, expected %v: %v", valid, test.valid, err)
+			}
+			if fmt.Sprint(suites) != fmt.Sprint(test.expected) {
+				t.Errorf("suites %v, expected %v", suites, test.expected)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+
+	tests := []struct {
+		name       string
+		options    string
+		clientAuth tls.ClientAuthType
+		minVersion uint16
+		valid      bool
+	}{
+		{"defaults", "", tls.NoClientCert, tls.VersionTLS12, true},
+		{"no client certificates", "client_auth: none", tls.NoClientCert, tls.VersionTLS12, true},
+		{"client certificates requested", "client_auth: request\n  client_ca_file: " + certFile, tls.VerifyClientCertIfGiven, tls.VersionTLS12, true},
+		{"client certificates required", "client_auth: require\n  client_ca_file: " + certFile, tls.RequireAndVerifyClientCert, tls.VersionTLS12, true},
+		{"client certificates without CA", "client_auth: require", 0, 0, false},
+		{"unknown client auth", "client_auth: optional\n  client_ca_file: " + certFile, 0, 0, false},
+		{"minimum version", "min_version: \"1.3\"", tls.NoClientCert, tls.VersionTLS13, true},
+		{"unknown version", "min_version: \"2.0\"", 0, 0, false},
+		{"unknown cipher suite", "cipher_suites: [TLS_NULL]", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.LoadForTest(t, fmt.Sprintf("tls:\n  enabled: yes\n  cert_file: %s\n  key_file: %s\n  %s\n", certFile, keyFile, test.options))
+
+			config, err := newTLSConfig()
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("valid = %v, expected %v: %v", valid, test.valid, err)
+			}
+			if !test.valid {
+				return
+			}
+
+			if config.ClientAuth != test.clientAuth || config.MinVersion != test.minVersion {
+				t.Errorf("client auth %v and version %x, expected %v and %x", config.ClientAuth, config.MinVersion, test.clientAuth, test.minVersion)
+			}
+
+			// the certificates are served by the config of each handshake
+			handshake, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+			if err != nil || len(handshake.Certificates) != 1 || serial(t, &handshake.Certificates[0]) != 1 {
+				t.Fatalf("handshake config without the certificate: %v", err)
+			}
+			if handshake.ClientAuth != test.clientAuth || (handshake.ClientCAs != nil) != (test.clientAuth != tls.NoClientCert) {
+				t.Errorf("handshake config does not verify the client certificates")
+			}
+		})
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, caFile: certFile}
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replaces the files with a new certificate, modified later than the loaded one
+	replace := func(serial int64) {
+		writeCertificate(t, dir, serial)
+		modified := reloader.modTime.Add(time.Minute)
+		for _, file := range []string{certFile, keyFile} {
+			if err := os.Chtimes(file, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if reloader.lastModification().After(reloader.modTime) {
+		t.Error("files changed after loading")
+	}
+
+	replace(2)
+	if !reloader.lastModification().After(reloader.modTime) {
+		t.Fatal("change not detected")
+	}
+	if err := reloader.reload(); err != nil || serial(t, reloader.cert) != 2 {
+		t.Errorf("certificate not reloaded: %v", err)
+	}
+
+	// broken files keep the current certificate
+	writeFile(t, keyFile, []byte("not a key"))
+	if err := reloader.reload(); err == nil {
+		t.Error("broken key loaded")
+	}
+	if serial(t, reloader.cert) != 2 || reloader.clientCAs == nil {
+		t.Error("certificates not kept")
+	}
+
+	writeFile(t, reloader.caFile, []byte("not a certificate"))
+	if err := reloader.reload(); err == nil {
+		t.Error("broken client CA file loaded")
+	}
+}